@@ -1,11 +1,15 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/psanford/hypr-buddy/config"
@@ -64,6 +68,65 @@ func (c *Client) ToggleStack() error {
 	return err
 }
 
+func (c *Client) ToggleGrid() error {
+	_, err := c.plainRequest("/toggle-grid")
+	return err
+}
+
+func (c *Client) ToggleCentered() error {
+	_, err := c.plainRequest("/toggle-centered")
+	return err
+}
+
+// MasterGrow changes the master width by step, a fraction of the monitor
+// width. Negative values shrink it.
+func (c *Client) MasterGrow(step float64) error {
+	_, err := c.plainRequest("/master-grow?step=" + strconv.FormatFloat(step, 'f', -1, 64))
+	return err
+}
+
+func (c *Client) AddMaster() error {
+	_, err := c.plainRequest("/master-count?n=1")
+	return err
+}
+
+// RemoveMaster makes one fewer window on the active workspace a master.
+func (c *Client) RemoveMaster() error {
+	_, err := c.plainRequest("/master-count?n=-1")
+	return err
+}
+
+// SetOrientation sets the active workspace's master orientation: left,
+// right, top, bottom or center.
+func (c *Client) SetOrientation(name string) error {
+	_, err := c.plainRequest("/orientation?name=" + url.QueryEscape(name))
+	return err
+}
+
+// SwapMaster swaps the active window with the master.
+func (c *Client) SwapMaster() error {
+	_, err := c.plainRequest("/swap-master")
+	return err
+}
+
+// SetMFact sets the master width to v, a fraction of the monitor width.
+func (c *Client) SetMFact(v float64) error {
+	_, err := c.plainRequest("/mfact?value=" + strconv.FormatFloat(v, 'f', -1, 64))
+	return err
+}
+
+// SetLayout switches the active workspace to the named layout.
+func (c *Client) SetLayout(name string) error {
+	_, err := c.plainRequest("/layout?name=" + url.QueryEscape(name))
+	return err
+}
+
+// NextLayout switches the active workspace to the next layout and returns
+// its name.
+func (c *Client) NextLayout() (string, error) {
+	return c.plainRequest("/layout-next")
+}
+
 func (c *Client) FocusNext() error {
 	_, err := c.plainRequest("/focus?n=1")
 	return err
@@ -74,16 +137,124 @@ func (c *Client) FocusPrev() error {
 	return err
 }
 
+// FocusMRU switches to the previously focused window. Calling it again
+// within the daemon's commit timeout goes further back in the history.
+func (c *Client) FocusMRU() error {
+	_, err := c.plainRequest("/focus-mru?n=1")
+	return err
+}
+
+// FocusMRUBack goes the other way through the history, starting from the
+// least recently used window.
+func (c *Client) FocusMRUBack() error {
+	_, err := c.plainRequest("/focus-mru?n=-1")
+	return err
+}
+
+// FocusWindow focuses the window with the given address. A window hidden
+// in a stack is made master first.
+func (c *Client) FocusWindow(addr string) error {
+	_, err := c.plainRequest("/focus-window?address=" + url.QueryEscape(addr))
+	return err
+}
+
+type WindowInfo struct {
+	Address string `json:"address"`
+	Class   string `json:"class"`
+	Title   string `json:"title"`
+	// WorkspaceID and WorkspaceName are the workspace the window belongs
+	// to. For hidden windows this is the stacked workspace, not the
+	// special workspace they are parked on.
+	WorkspaceID   int64  `json:"workspace_id"`
+	WorkspaceName string `json:"workspace_name"`
+	Floating      bool   `json:"floating"`
+	Hidden        bool   `json:"hidden"`
+}
+
+func (c *Client) Windows() ([]WindowInfo, error) {
+	body, err := c.plainRequest("/windows")
+	if err != nil {
+		return nil, err
+	}
+
+	var windows []WindowInfo
+	err = json.Unmarshal([]byte(body), &windows)
+	if err != nil {
+		return nil, err
+	}
+	return windows, nil
+}
+
 func (c *Client) UnhideAll() error {
 	_, err := c.plainRequest("/unhide-all")
 	return err
 }
 
+// MoveWindow moves the active window to workspace ws, switching to ws as
+// well if follow is set.
+func (c *Client) MoveWindow(ws int64, follow bool) error {
+	path := "/move-window?workspace=" + strconv.FormatInt(ws, 10)
+	if follow {
+		path += "&follow=1"
+	}
+	_, err := c.plainRequest(path)
+	return err
+}
+
+// Undo restores the window layout from before the last command that
+// changed it.
+func (c *Client) Undo() error {
+	_, err := c.plainRequest("/undo")
+	return err
+}
+
 func (c *Client) ToggleBling() error {
 	_, err := c.plainRequest("/toggle-bling")
 	return err
 }
 
+func (c *Client) Reconcile() error {
+	_, err := c.plainRequest("/reconcile")
+	return err
+}
+
+func (c *Client) Reload() error {
+	_, err := c.plainRequest("/reload")
+	return err
+}
+
+// SetProfile applies a named option profile. The name "restore" puts
+// back the options from before any profile was applied.
+func (c *Client) SetProfile(name string) error {
+	_, err := c.plainRequest("/profile?name=" + url.QueryEscape(name))
+	return err
+}
+
+type ProfileList struct {
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+func (c *Client) Profiles() (*ProfileList, error) {
+	body, err := c.plainRequest("/profiles")
+	if err != nil {
+		return nil, err
+	}
+
+	var list ProfileList
+	err = json.Unmarshal([]byte(body), &list)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Scratch toggles the named scratchpad from the config file.
+func (c *Client) Scratch(name string) error {
+	_, err := c.plainRequest("/scratch?name=" + url.QueryEscape(name))
+	return err
+}
+
 func (c *Client) plainRequest(path string) (string, error) {
 	resp, err := c.httpClient.Get(fakeHost + path)
 	if err != nil {
@@ -99,3 +270,25 @@ func (c *Client) plainRequest(path string) (string, error) {
 
 	return string(body), nil
 }
+
+// postRequest sends v as a JSON request body.
+func (c *Client) postRequest(path string, v interface{}) (string, error) {
+	reqBody, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.httpClient.Post(fakeHost+path, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("Bad response from server: %d %s", resp.StatusCode, body)
+	}
+
+	return string(body), nil
+}
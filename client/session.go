@@ -0,0 +1,77 @@
+package client
+
+import (
+	"encoding/json"
+)
+
+// Session is a saved window arrangement, as written by -save-session.
+type Session struct {
+	Windows    []SessionWindow    `json:"windows"`
+	Workspaces []SessionWorkspace `json:"workspaces"`
+}
+
+type SessionWindow struct {
+	// Address is the window's address when the session was saved. It
+	// only ties the window to WindowOrder entries; windows are matched
+	// back up by Class and Title.
+	Address string `json:"address"`
+	Class   string `json:"class"`
+	Title   string `json:"title"`
+
+	// Windows hidden in a stack are saved on the workspace they belong
+	// to, with Hidden set
+	WorkspaceID   int64  `json:"workspace_id"`
+	WorkspaceName string `json:"workspace_name"`
+	Hidden        bool   `json:"hidden"`
+
+	Floating bool     `json:"floating"`
+	At       [2]int64 `json:"at"`
+	Size     [2]int64 `json:"size"`
+}
+
+type SessionWorkspace struct {
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Layout      string   `json:"layout"`
+	WindowOrder []string `json:"window_order"`
+}
+
+// RestoreResult reports how a session restore went.
+type RestoreResult struct {
+	// Matched is the number of saved windows found running
+	Matched int `json:"matched"`
+	// Launched and Missing are the classes of saved windows that were
+	// started, or that had no command to start them
+	Launched []string `json:"launched"`
+	Missing  []string `json:"missing"`
+}
+
+// SaveSession returns the current window arrangement.
+func (c *Client) SaveSession() (*Session, error) {
+	body, err := c.plainRequest("/session")
+	if err != nil {
+		return nil, err
+	}
+
+	var sess Session
+	err = json.Unmarshal([]byte(body), &sess)
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// RestoreSession moves running windows back to where they were in sess.
+func (c *Client) RestoreSession(sess *Session) (*RestoreResult, error) {
+	body, err := c.postRequest("/session/restore", sess)
+	if err != nil {
+		return nil, err
+	}
+
+	var result RestoreResult
+	err = json.Unmarshal([]byte(body), &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// State is the daemon's view of the desktop, as sent by /events.
+type State struct {
+	// Workspace is the focused workspace. It is nil if the daemon
+	// doesn't know which workspace has focus yet.
+	Workspace    *WorkspaceState  `json:"workspace"`
+	Workspaces   []WorkspaceState `json:"workspaces"`
+	ActiveWindow string           `json:"active_window"`
+}
+
+type WorkspaceState struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Layout is "tiled", "stacked", "grid" or "centered"
+	Layout string `json:"layout"`
+	// Windows is the workspace's window order. When stacked the first
+	// window is the visible master and the rest are hidden.
+	Windows []string `json:"windows"`
+	Hidden  int      `json:"hidden"`
+}
+
+// Subscription is a stream of state updates from the daemon.
+type Subscription struct {
+	body io.ReadCloser
+	r    *bufio.Reader
+}
+
+// Subscribe connects to the daemon's /events stream. The first call to
+// Next returns the current state.
+func (c *Client) Subscribe(ctx context.Context) (*Subscription, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fakeHost+"/events", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Bad response from server: %d %s", resp.StatusCode, body)
+	}
+
+	return &Subscription{
+		body: resp.Body,
+		r:    bufio.NewReader(resp.Body),
+	}, nil
+}
+
+// Next blocks until the next state update arrives.
+func (sub *Subscription) Next() (*State, error) {
+	for {
+		line, err := sub.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		data, ok := strings.CutPrefix(strings.TrimRight(line, "\n"), "data: ")
+		if !ok {
+			continue
+		}
+
+		var st State
+		err = json.Unmarshal([]byte(data), &st)
+		if err != nil {
+			return nil, err
+		}
+		return &st, nil
+	}
+}
+
+func (sub *Subscription) Close() error {
+	return sub.body.Close()
+}
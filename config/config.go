@@ -35,3 +35,24 @@ func HyprRuntimeDir() string {
 
 	return fmt.Sprintf("%s/hypr/%s/", xdgDir, sig)
 }
+
+// StateDir is where the daemon persists state across restarts,
+// $XDG_STATE_HOME/hypr-buddy (default ~/.local/state/hypr-buddy).
+func StateDir() string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			panic(err)
+		}
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+	dir := filepath.Join(stateDir, "hypr-buddy")
+	os.MkdirAll(dir, 0755)
+
+	return dir
+}
+
+func StatePath() string {
+	return filepath.Join(StateDir(), "state.json")
+}
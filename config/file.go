@@ -0,0 +1,345 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is the user configuration loaded from ConfigPath. Any value not
+// set in the file keeps its default.
+type Config struct {
+	Workspaces WorkspacesConfig `toml:"workspaces"`
+	Master     MasterConfig     `toml:"master"`
+	Stack      StackConfig      `toml:"stack"`
+	Bling      BlingConfig      `toml:"bling"`
+	MRU        MRUConfig        `toml:"mru"`
+	Session    SessionConfig    `toml:"session"`
+
+	// Profiles are named sets of Hyprland options, keyed by option name,
+	// applied with -profile NAME
+	Profiles map[string]map[string]string `toml:"profiles"`
+
+	// Scratchpads are toggled with -scratch NAME
+	Scratchpads map[string]ScratchpadConfig `toml:"scratchpads"`
+
+	// Rules are checked in order against new windows and windows whose
+	// title changes
+	Rules []RuleConfig `toml:"rules"`
+}
+
+// RestoreProfile is the reserved profile name that puts back the option
+// values from before any profile was applied.
+const RestoreProfile = "restore"
+
+type WorkspacesConfig struct {
+	// Min and Max are the range -ws-next/-ws-prev cycle through
+	Min int64 `toml:"min"`
+	Max int64 `toml:"max"`
+}
+
+type MasterConfig struct {
+	// GrowStep is how much -master-grow/-master-shrink change mfact by
+	GrowStep float64 `toml:"grow_step"`
+}
+
+type StackConfig struct {
+	// HiddenWorkspace is the name of the workspace stacked windows are
+	// parked on. It must be a special workspace and contain a single %d
+	// for the ID of the workspace they belong to.
+	HiddenWorkspace string `toml:"hidden_workspace"`
+}
+
+type BlingConfig struct {
+	// On and Off map Hyprland option names to the values set by -bling
+	On  map[string]string `toml:"on"`
+	Off map[string]string `toml:"off"`
+}
+
+type MRUConfig struct {
+	// CommitTimeout is how long after the last -focus-mru the switch is
+	// final. Pressing again within it goes further back in the history.
+	CommitTimeout time.Duration `toml:"commit_timeout"`
+}
+
+type SessionConfig struct {
+	// Commands maps window classes to the command -restore-session runs
+	// for each saved window of that class that isn't open
+	Commands map[string]string `toml:"commands"`
+}
+
+type ScratchpadConfig struct {
+	// Command is run to start the app if the scratchpad has no window
+	Command string `toml:"command"`
+
+	// Class and Title are regular expressions that pick out the window
+	// Command opens. A window matches if its Class or InitialClass
+	// matches Class, and its Title matches Title. At least one must be
+	// set. Windows that were already open are never matched.
+	Class string `toml:"class"`
+	Title string `toml:"title"`
+
+	// Width and Height are the size to show the window at, in logical
+	// pixels. If unset the window takes 60% of the monitor.
+	Width  int64 `toml:"width"`
+	Height int64 `toml:"height"`
+
+	// classRe and titleRe are Class and Title compiled by validate
+	classRe *regexp.Regexp
+	titleRe *regexp.Regexp
+}
+
+// Match reports whether a window with the given class, initial class
+// and title could be the one Command opened.
+func (sc ScratchpadConfig) Match(class, initialClass, title string) bool {
+	return matchRe(sc.classRe, sc.titleRe, class, initialClass, title)
+}
+
+// RuleConfig is a window rule. Unlike Hyprland's windowrules these also
+// run when a window's title changes, but each rule only acts on a given
+// window once.
+type RuleConfig struct {
+	// Class and Title are regular expressions, matched like a
+	// scratchpad's. If set, Xwayland and Pid must equal the window's.
+	Class    string `toml:"class"`
+	Title    string `toml:"title"`
+	Xwayland *bool  `toml:"xwayland"`
+	Pid      int64  `toml:"pid"`
+
+	// Workspace sends the window to that workspace
+	Workspace int64 `toml:"workspace"`
+	// Float makes the window floating
+	Float bool `toml:"float"`
+	// NoStack keeps the window out of stacked, grid and centered
+	// workspaces' window order; it stays tiled where Hyprland put it
+	NoStack bool `toml:"no_stack"`
+	// Pin floats the window and shows it on every workspace
+	Pin bool `toml:"pin"`
+	// Scratchpad hands the window to the named scratchpad, hidden
+	Scratchpad string `toml:"scratchpad"`
+
+	// classRe and titleRe are Class and Title compiled by validate
+	classRe *regexp.Regexp
+	titleRe *regexp.Regexp
+}
+
+// Match reports whether a window matches the rule.
+func (rc RuleConfig) Match(class, initialClass, title string, xwayland bool, pid int64) bool {
+	if rc.Xwayland != nil && *rc.Xwayland != xwayland {
+		return false
+	}
+	if rc.Pid != 0 && rc.Pid != pid {
+		return false
+	}
+	return matchRe(rc.classRe, rc.titleRe, class, initialClass, title)
+}
+
+// matchRe reports whether class or initialClass matches classRe and
+// title matches titleRe. A nil expression matches anything.
+func matchRe(classRe, titleRe *regexp.Regexp, class, initialClass, title string) bool {
+	if classRe != nil && !classRe.MatchString(class) && !classRe.MatchString(initialClass) {
+		return false
+	}
+	if titleRe != nil && !titleRe.MatchString(title) {
+		return false
+	}
+	return true
+}
+
+var scratchpadNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// optionNameRe matches Hyprland option names like general:gaps_in or
+// decoration:blur:enabled.
+var optionNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]+(:[a-zA-Z0-9_.-]+)+$`)
+
+func Default() *Config {
+	return &Config{
+		Workspaces: WorkspacesConfig{
+			Min: 1,
+			Max: 10,
+		},
+		Master: MasterConfig{
+			GrowStep: 0.05,
+		},
+		Stack: StackConfig{
+			HiddenWorkspace: "special:hidden-%d",
+		},
+		Bling: BlingConfig{
+			On: map[string]string{
+				"animations:enabled":  "yes",
+				"general:gaps_in":     "5",
+				"general:gaps_out":    "20",
+				"decoration:rounding": "10",
+			},
+			Off: map[string]string{
+				"animations:enabled":  "no",
+				"general:gaps_in":     "0",
+				"general:gaps_out":    "0",
+				"decoration:rounding": "0",
+			},
+		},
+		MRU: MRUConfig{
+			CommitTimeout: time.Second,
+		},
+	}
+}
+
+// ConfigPath is $XDG_CONFIG_HOME/hypr-buddy/config.toml.
+func ConfigPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		panic(err)
+	}
+	return filepath.Join(configDir, "hypr-buddy", "config.toml")
+}
+
+// Load reads ConfigPath. A missing file is not an error. On error the
+// default config is returned along with the error.
+func Load() (*Config, error) {
+	return LoadFile(ConfigPath())
+}
+
+func LoadFile(path string) (*Config, error) {
+	var cfg Config
+	_, err := toml.DecodeFile(path, &cfg)
+	if errors.Is(err, os.ErrNotExist) {
+		return Default(), nil
+	} else if err != nil {
+		return Default(), fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	cfg.setDefaults()
+
+	err = cfg.validate()
+	if err != nil {
+		return Default(), fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+func (c *Config) setDefaults() {
+	def := Default()
+
+	if c.Workspaces.Min == 0 {
+		c.Workspaces.Min = def.Workspaces.Min
+	}
+	if c.Workspaces.Max == 0 {
+		c.Workspaces.Max = def.Workspaces.Max
+	}
+	if c.Master.GrowStep == 0 {
+		c.Master.GrowStep = def.Master.GrowStep
+	}
+	if c.Stack.HiddenWorkspace == "" {
+		c.Stack.HiddenWorkspace = def.Stack.HiddenWorkspace
+	}
+	if c.MRU.CommitTimeout == 0 {
+		c.MRU.CommitTimeout = def.MRU.CommitTimeout
+	}
+	if c.Bling.On == nil {
+		c.Bling.On = def.Bling.On
+	}
+	if c.Bling.Off == nil {
+		c.Bling.Off = def.Bling.Off
+	}
+}
+
+func (c *Config) validate() error {
+	if c.Workspaces.Min < 1 || c.Workspaces.Max < c.Workspaces.Min {
+		return fmt.Errorf("invalid workspaces range %d-%d", c.Workspaces.Min, c.Workspaces.Max)
+	}
+
+	hidden := c.Stack.HiddenWorkspace
+	if !strings.HasPrefix(hidden, "special:") {
+		return fmt.Errorf("stack.hidden_workspace %q must be a special: workspace", hidden)
+	}
+	if strings.Count(hidden, "%") != 1 || !strings.Contains(hidden, "%d") {
+		return fmt.Errorf("stack.hidden_workspace %q must contain exactly one %%d", hidden)
+	}
+
+	if _, ok := c.Profiles[RestoreProfile]; ok {
+		return fmt.Errorf("profile name %q is reserved", RestoreProfile)
+	}
+	for name, opts := range c.Profiles {
+		for opt := range opts {
+			if !optionNameRe.MatchString(opt) {
+				return fmt.Errorf("profile %s: invalid option name %q", name, opt)
+			}
+		}
+	}
+
+	if c.MRU.CommitTimeout < 0 {
+		return fmt.Errorf("invalid mru.commit_timeout %s", c.MRU.CommitTimeout)
+	}
+
+	for name, sc := range c.Scratchpads {
+		if !scratchpadNameRe.MatchString(name) {
+			return fmt.Errorf("scratchpad name %q may only contain letters, digits, - and _", name)
+		}
+		if sc.Command == "" {
+			return fmt.Errorf("scratchpad %s: command is required", name)
+		}
+		if sc.Class == "" && sc.Title == "" {
+			return fmt.Errorf("scratchpad %s: class or title is required", name)
+		}
+		var err error
+		sc.classRe, err = compileOptional(sc.Class)
+		if err != nil {
+			return fmt.Errorf("scratchpad %s: %w", name, err)
+		}
+		sc.titleRe, err = compileOptional(sc.Title)
+		if err != nil {
+			return fmt.Errorf("scratchpad %s: %w", name, err)
+		}
+		if sc.Width < 0 || sc.Height < 0 {
+			return fmt.Errorf("scratchpad %s: invalid size %dx%d", name, sc.Width, sc.Height)
+		}
+		c.Scratchpads[name] = sc
+	}
+
+	for i := range c.Rules {
+		rc := &c.Rules[i]
+		if rc.Class == "" && rc.Title == "" && rc.Xwayland == nil && rc.Pid == 0 {
+			return fmt.Errorf("rule %d: class, title, xwayland or pid is required", i)
+		}
+		var err error
+		rc.classRe, err = compileOptional(rc.Class)
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		rc.titleRe, err = compileOptional(rc.Title)
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+		if !rc.Float && !rc.NoStack && !rc.Pin && rc.Workspace == 0 && rc.Scratchpad == "" {
+			return fmt.Errorf("rule %d: no actions", i)
+		}
+		if rc.Workspace < 0 {
+			return fmt.Errorf("rule %d: invalid workspace %d", i, rc.Workspace)
+		}
+		if rc.Scratchpad != "" {
+			if _, ok := c.Scratchpads[rc.Scratchpad]; !ok {
+				return fmt.Errorf("rule %d: unknown scratchpad %q", i, rc.Scratchpad)
+			}
+			if rc.Workspace != 0 {
+				return fmt.Errorf("rule %d: workspace and scratchpad are mutually exclusive", i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// compileOptional compiles expr, or returns nil if it is empty.
+func compileOptional(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
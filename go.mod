@@ -2,6 +2,9 @@ module github.com/psanford/hypr-buddy
 
 go 1.21.4
 
-require github.com/psanford/logmiddleware v0.0.0-20231209180300-4afd915e4acf
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/psanford/logmiddleware v0.0.0-20231209180300-4afd915e4acf
+)
 
 require github.com/felixge/httpsnoop v1.0.1 // indirect
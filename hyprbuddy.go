@@ -2,48 +2,118 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/psanford/hypr-buddy/client"
+	"github.com/psanford/hypr-buddy/config"
 	"github.com/psanford/hypr-buddy/hyprctl"
 	"github.com/psanford/hypr-buddy/server"
 )
 
 var doGotoNextWorkspace = flag.Bool("ws-next", false, "goto next workspace")
 var doGotoPrevWorkspace = flag.Bool("ws-prev", false, "goto next workspace")
+var wsMonitorOnly = flag.Bool("ws-monitor", false, "with -ws-next/-ws-prev/-move-next/-move-prev and -ws-mode all, only cycle through workspaces on the focused monitor")
+var doMoveNext = flag.Bool("move-next", false, "move the active window to the next workspace")
+var doMovePrev = flag.Bool("move-prev", false, "move the active window to the previous workspace")
+var moveFollow = flag.Bool("follow", false, "with -move-next/-move-prev, switch to the window's new workspace")
+var wsMode = flag.String("ws-mode", wsModeAll, "with -ws-next/-ws-prev/-move-next/-move-prev, which workspaces to visit: all, occupied (only ones with windows on the focused monitor) or dynamic (occupied plus one empty workspace at the end)")
 
 var doMasterGrow = flag.Bool("master-grow", false, "grow master region")
 var doMasterShrink = flag.Bool("master-shrink", false, "shrink master region")
+var mfact = flag.Float64("mfact", 0, "set the master region to this fraction of the screen (0.05-0.95)")
+var doAddMaster = flag.Bool("add-master", false, "add a master window")
+var doRemoveMaster = flag.Bool("remove-master", false, "remove a master window")
+var orientation = flag.String("orientation", "", "set the master orientation (left, right, top, bottom, center)")
+var doSwapMaster = flag.Bool("swap-master", false, "swap the active window with the master")
 var doToggleStack = flag.Bool("toggle-stack", false, "toggle stacked windows")
+var doToggleGrid = flag.Bool("toggle-grid", false, "toggle grid layout")
+var doToggleCentered = flag.Bool("toggle-centered", false, "toggle centered master layout")
+var layout = flag.String("layout", "", "set the workspace layout (tiled, stacked, grid, centered)")
+var doNextLayout = flag.Bool("layout-next", false, "switch the workspace to the next layout")
 var runDaemon = flag.Bool("daemon", false, "run daemon")
 var doPing = flag.Bool("ping", false, "ping daemon")
 
 var doFocusNext = flag.Bool("focus-next", false, "focus next window")
 var doFocusPrev = flag.Bool("focus-prev", false, "focus prev window")
+var focusAddr = flag.String("focus", "", "focus the window with this address, unhiding it if it is stacked")
+var doListWindows = flag.Bool("list-windows", false, "list windows for dmenu style pickers")
+var doFocusMRU = flag.Bool("focus-mru", false, "focus the previously used window; repeat to go further back")
+var doFocusMRUBack = flag.Bool("focus-mru-back", false, "like -focus-mru but in the other direction")
 var doUnhideAll = flag.Bool("unhide-all", false, "reset all hidden windows")
+var doUndo = flag.Bool("undo", false, "undo the last layout change")
+var saveSessionFile = flag.String("save-session", "", "save the window arrangement to this file")
+var restoreSessionFile = flag.String("restore-session", "", "move windows back to the arrangement saved in this file")
 var doToggleBling = flag.Bool("bling", false, "toggle bling")
-
-const wsMax = 10
-const wsMin = 1
+var doReconcile = flag.Bool("reconcile", false, "fix up stacked workspaces that drifted from the daemon's state")
+var doReload = flag.Bool("reload", false, "make the daemon reload its config file")
+var profile = flag.String("profile", "", "apply the named option profile from the config file (\"restore\" to undo)")
+var doListProfiles = flag.Bool("profiles", false, "list option profiles")
+var scratch = flag.String("scratch", "", "show, hide or start the named scratchpad from the config file")
+var doWatch = flag.Bool("watch", false, "print the daemon's state as a JSON line every time it changes")
+var doWaybar = flag.Bool("waybar", false, "print status for a waybar custom module")
+var waybarButton = flag.String("waybar-click", "", "handle a click on the waybar module (left, right, scroll-up, scroll-down)")
 
 func main() {
 	flag.Parse()
 
+	cfg, err := config.Load()
+	if err != nil {
+		log.Printf("load config err: %s", err)
+	}
+
 	if *runDaemon {
 		ctx := context.Background()
 		server.New().Serve(ctx)
 	} else if *doGotoNextWorkspace {
-		gotoNextWS(1)
+		gotoNextWS(cfg, 1, *wsMonitorOnly, *wsMode)
 	} else if *doGotoPrevWorkspace {
-		gotoNextWS(-1)
+		gotoNextWS(cfg, -1, *wsMonitorOnly, *wsMode)
+	} else if *doMoveNext {
+		moveToNextWS(cfg, 1, *wsMonitorOnly, *wsMode, *moveFollow)
+	} else if *doMovePrev {
+		moveToNextWS(cfg, -1, *wsMonitorOnly, *wsMode, *moveFollow)
 	} else if *doMasterGrow {
-		masterGrow(0.05)
+		err := client.NewClient().MasterGrow(cfg.Master.GrowStep)
+		if err != nil {
+			log.Fatal(err)
+		}
 	} else if *doMasterShrink {
-		masterGrow(-0.05)
+		err := client.NewClient().MasterGrow(-cfg.Master.GrowStep)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if isFlagSet("mfact") {
+		err := client.NewClient().SetMFact(*mfact)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doAddMaster {
+		err := client.NewClient().AddMaster()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doRemoveMaster {
+		err := client.NewClient().RemoveMaster()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *orientation != "" {
+		err := client.NewClient().SetOrientation(*orientation)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doSwapMaster {
+		err := client.NewClient().SwapMaster()
+		if err != nil {
+			log.Fatal(err)
+		}
 	} else if *doPing {
 		err := client.NewClient().Ping()
 		if err != nil {
@@ -56,6 +126,27 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+	} else if *doToggleGrid {
+		err := client.NewClient().ToggleGrid()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doToggleCentered {
+		err := client.NewClient().ToggleCentered()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *layout != "" {
+		err := client.NewClient().SetLayout(*layout)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doNextLayout {
+		name, err := client.NewClient().NextLayout()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s\n", name)
 	} else if *doFocusNext {
 		err := client.NewClient().FocusNext()
 		if err != nil {
@@ -66,6 +157,26 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+	} else if *focusAddr != "" {
+		err := client.NewClient().FocusWindow(*focusAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doListWindows {
+		err := listWindows()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doFocusMRU {
+		err := client.NewClient().FocusMRU()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doFocusMRUBack {
+		err := client.NewClient().FocusMRUBack()
+		if err != nil {
+			log.Fatal(err)
+		}
 	} else if *doUnhideAll {
 		err := client.NewClient().UnhideAll()
 		if err != nil {
@@ -76,89 +187,343 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+	} else if *profile != "" {
+		err := client.NewClient().SetProfile(*profile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doListProfiles {
+		list, err := client.NewClient().Profiles()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, name := range list.Profiles {
+			marker := " "
+			if name == list.Active {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+	} else if *scratch != "" {
+		err := client.NewClient().Scratch(*scratch)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doUndo {
+		err := client.NewClient().Undo()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *saveSessionFile != "" {
+		err := saveSession(*saveSessionFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *restoreSessionFile != "" {
+		err := restoreSession(*restoreSessionFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doWatch {
+		err := watch()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doWaybar {
+		runWaybar()
+	} else if *waybarButton != "" {
+		err := waybarClick(*waybarButton)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doReload {
+		err := client.NewClient().Reload()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *doReconcile {
+		err := client.NewClient().Reconcile()
+		if err != nil {
+			log.Fatal(err)
+		}
 	} else {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 }
 
-func masterGrow(n float64) {
-	c, err := hyprctl.New()
+// listWindows prints one line per window, with the address before a tab
+// so it can be cut out of the picker's selection:
+//
+//	hypr-buddy -focus "$(hypr-buddy -list-windows | fuzzel -d | cut -f1)"
+func listWindows() error {
+	windows, err := client.NewClient().Windows()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	windows := activeWorkspaceWindows(c)
+	for _, w := range windows {
+		where := "ws " + w.WorkspaceName
+		if w.Hidden {
+			where += ", hidden"
+		} else if w.Floating {
+			where += ", floating"
+		}
+		title := strings.ReplaceAll(w.Title, "\t", " ")
+		fmt.Printf("%s\t[%s] %s (%s)\n", w.Address, w.Class, title, where)
+	}
+	return nil
+}
 
-	master := windows[0]
-	width := master.Size[0]
+func saveSession(path string) error {
+	sess, err := client.NewClient().SaveSession()
+	if err != nil {
+		return err
+	}
 
-	monitors, err := c.Monitors()
+	out, err := json.MarshalIndent(sess, "", "  ")
 	if err != nil {
-		panic(err)
+		return err
 	}
+	return os.WriteFile(path, append(out, '\n'), 0600)
+}
 
-	var monitorWidth float64
-	for _, m := range monitors {
-		if m.ID == master.Monitor {
-			monitorWidth = float64(m.Width) / m.Scale
-			break
-		}
+func restoreSession(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var sess client.Session
+	err = json.Unmarshal(data, &sess)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	result, err := client.NewClient().RestoreSession(&sess)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("restored %d of %d windows\n", result.Matched, len(sess.Windows))
+	if len(result.Launched) > 0 {
+		fmt.Printf("started: %s\n", strings.Join(result.Launched, ", "))
+	}
+	if len(result.Missing) > 0 {
+		fmt.Printf("missing: %s\n", strings.Join(result.Missing, ", "))
 	}
+	return nil
+}
 
-	curRatio := float64(width) / float64(monitorWidth)
+func watch() error {
+	sub, err := client.NewClient().Subscribe(context.Background())
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
 
-	newRatio := curRatio + n
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		st, err := sub.Next()
+		if err != nil {
+			return err
+		}
+		enc.Encode(st)
+	}
+}
 
-	c.DispatchRaw(fmt.Sprintf("layoutmsg mfact %.02f", newRatio))
-	c.DispatchRaw("forcerendererreload")
+// isFlagSet reports whether the named flag was given on the command line,
+// for flags whose zero value is a valid setting.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
 }
 
-func gotoNextWS(n int64) {
+const (
+	wsModeAll      = "all"
+	wsModeOccupied = "occupied"
+	wsModeDynamic  = "dynamic"
+)
+
+func gotoNextWS(cfg *config.Config, n int64, monitorOnly bool, mode string) {
 	c, err := hyprctl.New()
 	if err != nil {
 		panic(err)
 	}
 
-	wsInfo, err := c.ActiveWorkspace()
+	nextID := nextWS(c, cfg, n, monitorOnly, mode)
+
+	err = c.DispatchRaw(fmt.Sprintf("workspace %d", nextID))
 	if err != nil {
 		panic(err)
 	}
+}
 
-	nextID := wsInfo.ID + n
-	if nextID > wsMax {
-		nextID = wsMin
-	}
-	if nextID < wsMin {
-		nextID = wsMax
+// moveToNextWS moves the active window to the workspace gotoNextWS would
+// go to. The daemon does the move so it can keep stacks in order.
+func moveToNextWS(cfg *config.Config, n int64, monitorOnly bool, mode string, follow bool) {
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
 	}
 
-	err = c.DispatchRaw(fmt.Sprintf("workspace %d", nextID))
+	nextID := nextWS(c, cfg, n, monitorOnly, mode)
+
+	err = client.NewClient().MoveWindow(nextID, follow)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 }
 
-func activeWorkspaceWindows(c *hyprctl.Client) []hyprctl.Window {
+// nextWS returns the workspace n steps from the active one.
+func nextWS(c *hyprctl.Client, cfg *config.Config, n int64, monitorOnly bool, mode string) int64 {
+	if mode != wsModeAll && mode != wsModeOccupied && mode != wsModeDynamic {
+		log.Fatalf("unknown -ws-mode %q", mode)
+	}
+	if monitorOnly && mode != wsModeAll {
+		log.Fatalf("-ws-monitor only applies to -ws-mode all; -ws-mode %s always stays on the focused monitor", mode)
+	}
+
 	wsInfo, err := c.ActiveWorkspace()
 	if err != nil {
 		panic(err)
 	}
 
-	allWindows, err := c.Windows()
+	workspaces, err := c.Workspaces()
 	if err != nil {
 		panic(err)
 	}
 
-	var wsWindows []hyprctl.Window
-	for _, w := range allWindows {
-		if w.Workspace.ID == wsInfo.ID {
-			wsWindows = append(wsWindows, w)
+	var nextID int64
+	if mode != wsModeAll {
+		nextID = nextOccupiedWS(wsInfo, workspaces, n, mode == wsModeDynamic)
+	} else if monitorOnly {
+		// older versions of Hyprland don't support workspacerules
+		rules, _ := c.WorkspaceRules()
+		nextID = nextMonitorWS(wsInfo, workspaces, rules, n)
+	} else {
+		// cycle through at least Min..Max, extended to cover any higher
+		// numbered workspace that currently exists
+		wsMin := cfg.Workspaces.Min
+		maxID := cfg.Workspaces.Max
+		for _, ws := range workspaces {
+			if ws.ID > maxID {
+				maxID = ws.ID
+			}
+		}
+
+		nextID = wsInfo.ID + n
+		if nextID > maxID {
+			nextID = wsMin
+		}
+		if nextID < wsMin {
+			nextID = maxID
+		}
+	}
+
+	return nextID
+}
+
+// nextMonitorWS picks the next numbered workspace on the same monitor as
+// wsInfo. A workspace is on the monitor if it currently lives there or if a
+// workspace rule binds it there.
+func nextMonitorWS(wsInfo *hyprctl.Workspace, workspaces []hyprctl.Workspace, rules []hyprctl.WorkspaceRule, n int64) int64 {
+	idSet := make(map[int64]bool)
+	for _, ws := range workspaces {
+		if ws.MonitorID == wsInfo.MonitorID && ws.ID > 0 {
+			idSet[ws.ID] = true
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.Monitor != wsInfo.Monitor {
+			continue
+		}
+		id, err := strconv.ParseInt(rule.WorkspaceString, 10, 64)
+		if err == nil && id > 0 {
+			idSet[id] = true
 		}
 	}
-	sort.Sort(WindowSort(wsWindows))
 
-	return wsWindows
+	return cycleWS(idSet, wsInfo.ID, n)
+}
+
+// nextOccupiedWS picks the next numbered workspace with windows on the
+// same monitor as wsInfo. With dynamic set, one empty workspace after the
+// last occupied one is also visited, so there is always somewhere new to
+// go, like GNOME's dynamic workspaces.
+func nextOccupiedWS(wsInfo *hyprctl.Workspace, workspaces []hyprctl.Workspace, n int64, dynamic bool) int64 {
+	// the current workspace is always included so we know where we are
+	// in the cycle, even if it is empty
+	idSet := map[int64]bool{wsInfo.ID: true}
+	taken := make(map[int64]bool)
+	var maxID int64
+	for _, ws := range workspaces {
+		if ws.ID <= 0 {
+			continue
+		}
+		taken[ws.ID] = true
+		if ws.MonitorID == wsInfo.MonitorID && ws.Windows > 0 {
+			idSet[ws.ID] = true
+			maxID = max(maxID, ws.ID)
+		}
+	}
+
+	if dynamic {
+		empty := maxID + 1
+		if wsInfo.ID > maxID {
+			// already on the empty workspace at the end
+			empty = wsInfo.ID
+		}
+		for taken[empty] && empty != wsInfo.ID {
+			// in use on another monitor
+			empty++
+		}
+		idSet[empty] = true
+	}
+
+	return cycleWS(idSet, wsInfo.ID, n)
+}
+
+// cycleWS returns the workspace n steps from cur in the sorted ids,
+// wrapping around at either end.
+func cycleWS(idSet map[int64]bool, cur, n int64) int64 {
+	ids := make([]int64, 0, len(idSet))
+	for id := range idSet {
+		if id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	if len(ids) == 0 {
+		return cur
+	}
+
+	idx := -1
+	for i, id := range ids {
+		if id == cur {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		// on a named workspace; start from either end
+		if n > 0 {
+			return ids[0]
+		}
+		return ids[len(ids)-1]
+	}
+
+	next := (int64(idx) + n) % int64(len(ids))
+	if next < 0 {
+		next += int64(len(ids))
+	}
+	return ids[next]
 }
 
 type WindowSort []hyprctl.Window
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/psanford/hypr-buddy/client"
+	"github.com/psanford/hypr-buddy/hyprctl"
+	"github.com/psanford/hypr-buddy/hyprtest"
+)
+
+func TestCycleWS(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []int64
+		cur  int64
+		n    int64
+		want int64
+	}{
+		{"next", []int64{1, 3, 5}, 3, 1, 5},
+		{"prev", []int64{1, 3, 5}, 3, -1, 1},
+		{"wrap forward", []int64{1, 3, 5}, 5, 1, 1},
+		{"wrap backward", []int64{1, 3, 5}, 1, -1, 5},
+		{"several steps", []int64{1, 3, 5}, 1, 4, 3},
+		{"only one", []int64{2}, 2, 1, 2},
+		{"no workspaces", nil, 4, 1, 4},
+		{"named workspace forward", []int64{2, 4}, -98, 1, 2},
+		{"named workspace backward", []int64{2, 4}, -98, -1, 4},
+		{"special ids skipped", []int64{-99, 2, 4}, 4, 1, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idSet := make(map[int64]bool)
+			for _, id := range tt.ids {
+				idSet[id] = true
+			}
+			if got := cycleWS(idSet, tt.cur, tt.n); got != tt.want {
+				t.Errorf("cycleWS(%v, %d, %d) = %d, want %d", tt.ids, tt.cur, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextOccupiedWS(t *testing.T) {
+	// workspaces 1, 3 and 4 have windows on monitor 0, 2 is empty and 5
+	// is on monitor 1
+	workspaces := []hyprctl.Workspace{
+		{ID: 1, MonitorID: 0, Windows: 2},
+		{ID: 2, MonitorID: 0, Windows: 0},
+		{ID: 3, MonitorID: 0, Windows: 1},
+		{ID: 4, MonitorID: 0, Windows: 3},
+		{ID: 5, MonitorID: 1, Windows: 1},
+		{ID: -98, MonitorID: 0, Windows: 1, Name: "special:hidden-1"},
+	}
+
+	tests := []struct {
+		name    string
+		cur     int64
+		n       int64
+		dynamic bool
+		want    int64
+	}{
+		{"occupied skips empty", 1, 1, false, 3},
+		{"occupied prev skips empty", 3, -1, false, 1},
+		{"occupied wraps forward", 4, 1, false, 1},
+		{"occupied wraps backward", 1, -1, false, 4},
+		{"occupied from empty workspace", 2, 1, false, 3},
+		{"occupied from empty workspace backward", 2, -1, false, 1},
+		// 5 is taken by the other monitor, so the empty one is 6
+		{"dynamic visits one empty", 4, 1, true, 6},
+		{"dynamic wraps from empty", 6, 1, true, 1},
+		{"dynamic wraps backward to empty", 1, -1, true, 6},
+		{"dynamic empty back to last occupied", 6, -1, true, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wsInfo := &hyprctl.Workspace{ID: tt.cur, MonitorID: 0}
+			if got := nextOccupiedWS(wsInfo, workspaces, tt.n, tt.dynamic); got != tt.want {
+				t.Errorf("nextOccupiedWS(%d, %d, dynamic=%t) = %d, want %d", tt.cur, tt.n, tt.dynamic, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("dynamic on empty monitor", func(t *testing.T) {
+		wsInfo := &hyprctl.Workspace{ID: 7, MonitorID: 2}
+		if got := nextOccupiedWS(wsInfo, workspaces, 1, true); got != 7 {
+			t.Errorf("nextOccupiedWS = %d, want 7", got)
+		}
+	})
+}
+
+func TestNextMonitorWS(t *testing.T) {
+	// monitor DP-1 has workspaces 1 and 4, with 6 bound to it by a rule,
+	// and HDMI-A-1 has 2 and 3
+	workspaces := []hyprctl.Workspace{
+		{ID: 1, MonitorID: 0, Monitor: "DP-1"},
+		{ID: 2, MonitorID: 1, Monitor: "HDMI-A-1"},
+		{ID: 3, MonitorID: 1, Monitor: "HDMI-A-1"},
+		{ID: 4, MonitorID: 0, Monitor: "DP-1"},
+		{ID: -98, MonitorID: 0, Monitor: "DP-1", Name: "special:hidden-1"},
+	}
+	rules := []hyprctl.WorkspaceRule{
+		{WorkspaceString: "6", Monitor: "DP-1"},
+		{WorkspaceString: "5", Monitor: "HDMI-A-1"},
+		{WorkspaceString: "name:web", Monitor: "DP-1"},
+	}
+
+	dp1 := func(id int64) *hyprctl.Workspace {
+		return &hyprctl.Workspace{ID: id, MonitorID: 0, Monitor: "DP-1"}
+	}
+	hdmi := func(id int64) *hyprctl.Workspace {
+		return &hyprctl.Workspace{ID: id, MonitorID: 1, Monitor: "HDMI-A-1"}
+	}
+
+	tests := []struct {
+		name  string
+		ws    *hyprctl.Workspace
+		rules []hyprctl.WorkspaceRule
+		n     int64
+		want  int64
+	}{
+		{"next skips other monitor", dp1(1), rules, 1, 4},
+		{"next includes rule bound workspace", dp1(4), rules, 1, 6},
+		{"wraps forward", dp1(6), rules, 1, 1},
+		{"wraps backward", dp1(1), rules, -1, 6},
+		{"prev skips other monitor", dp1(4), rules, -1, 1},
+		{"other monitor next", hdmi(2), rules, 1, 3},
+		{"other monitor rule bound", hdmi(3), rules, 1, 5},
+		{"other monitor wraps forward", hdmi(5), rules, 1, 2},
+		{"other monitor wraps backward", hdmi(2), rules, -1, 5},
+		{"no rules wraps", dp1(4), nil, 1, 1},
+		{"no rules wraps backward", dp1(1), nil, -1, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextMonitorWS(tt.ws, workspaces, tt.rules, tt.n); got != tt.want {
+				t.Errorf("nextMonitorWS(%d on %s, %d) = %d, want %d", tt.ws.ID, tt.ws.Monitor, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaybarRenderPosition(t *testing.T) {
+	h := hyprtest.NewServer()
+	t.Cleanup(h.Close)
+	h.Setenv(t)
+
+	a := h.OpenWindow(hyprtest.WindowSpec{Class: "a"})
+	b := h.OpenWindow(hyprtest.WindowSpec{Class: "b"})
+	f := h.OpenWindow(hyprtest.WindowSpec{Class: "f", Floating: true})
+
+	tests := []struct {
+		name    string
+		layout  string
+		windows []string
+		active  string
+		want    string
+	}{
+		// the newest window is master, so b is first
+		{"master", "tiled", nil, b, "[1/2] b"},
+		{"stack", "tiled", nil, a, "[2/2] a"},
+		{"floating", "tiled", nil, f, "[-/2] f"},
+		{"unknown", "tiled", nil, "0xdead", "[-/2]"},
+		{"stacked master", "stacked", []string{b, a}, b, "[1/2] b"},
+		{"stacked floating", "stacked", []string{b, a}, f, "[-/2] f"},
+		{"grid floating", "grid", []string{a, b}, f, "[-/2] f"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &client.State{
+				Workspace: &client.WorkspaceState{
+					ID:      1,
+					Name:    "1",
+					Layout:  tt.layout,
+					Windows: tt.windows,
+				},
+				ActiveWindow: tt.active,
+			}
+			out, err := waybarRender(st)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Text != tt.want {
+				t.Errorf("text = %q, want %q", out.Text, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package hyprctl
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// Batch collects dispatches and keywords so they can be sent to Hyprland
+// as a single [[BATCH]] request. Hyprland applies the whole batch before
+// rendering the next frame, so multi-step rearrangements don't flicker.
+//
+// Hyprland splits batches on ';', so individual commands must not
+// contain one.
+type Batch struct {
+	c    *Client
+	cmds []string
+}
+
+type BatchResult struct {
+	Cmd string
+	// Err is nil if Hyprland replied "ok" to Cmd.
+	Err error
+}
+
+func (c *Client) Batch() *Batch {
+	return &Batch{
+		c: c,
+	}
+}
+
+func (b *Batch) Dispatch(args string) {
+	b.cmds = append(b.cmds, "/dispatch "+args)
+}
+
+func (b *Batch) Dispatchf(format string, a ...interface{}) {
+	b.Dispatch(fmt.Sprintf(format, a...))
+}
+
+func (b *Batch) SetOption(opt, value string) {
+	b.cmds = append(b.cmds, fmt.Sprintf("/keyword %s %s", opt, value))
+}
+
+func (b *Batch) Len() int {
+	return len(b.cmds)
+}
+
+// Run sends the batch and returns one result per command, in the order
+// they were added. The returned error is non-nil if the request failed or
+// if any command in the batch failed. An empty batch is a no-op.
+func (b *Batch) Run() ([]BatchResult, error) {
+	if len(b.cmds) == 0 {
+		return nil, nil
+	}
+
+	if b.c.LogCmds {
+		for _, cmd := range b.cmds {
+			log.Printf("[batch] %s", cmd)
+		}
+	}
+
+	conn, err := b.c.conn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", b.c.p, err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("[[BATCH]]" + strings.Join(b.cmds, ";")))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	replies := strings.Split(string(body), "\n\n\n")
+
+	var firstErr error
+	results := make([]BatchResult, len(b.cmds))
+	for i, cmd := range b.cmds {
+		results[i].Cmd = cmd
+
+		reply := "missing reply"
+		if i < len(replies) {
+			reply = strings.TrimSpace(replies[i])
+		}
+		if reply != "ok" {
+			results[i].Err = fmt.Errorf("error result: %s", reply)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("batch command %d (%s) failed: %w", i, cmd, results[i].Err)
+			}
+		}
+	}
+
+	return results, firstErr
+}
@@ -0,0 +1,133 @@
+package hyprctl
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSocket serves reply to every request on a unix socket and sends
+// the requests it gets on the returned channel.
+func fakeSocket(t *testing.T, reply string) (*Client, <-chan string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), ".socket.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	reqs := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 8192)
+			n, err := conn.Read(buf)
+			if err == nil {
+				reqs <- string(buf[:n])
+				io.WriteString(conn, reply)
+			}
+			conn.Close()
+		}
+	}()
+
+	c, err := NewFromPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, reqs
+}
+
+func TestBatchRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    string
+		wantErrs []bool
+		// wantErr is a substring of the error Run returns, or "" for
+		// none
+		wantErr string
+	}{
+		{
+			name:     "all ok",
+			reply:    "ok\n\n\nok\n\n\nok",
+			wantErrs: []bool{false, false, false},
+		},
+		{
+			name:     "trailing whitespace",
+			reply:    "ok\n\n\nok \n\n\nok\n",
+			wantErrs: []bool{false, false, false},
+		},
+		{
+			name:     "one failure",
+			reply:    "ok\n\n\nInvalid dispatcher\n\n\nok",
+			wantErrs: []bool{false, true, false},
+			wantErr:  "batch command 1 (/dispatch bogus) failed: error result: Invalid dispatcher",
+		},
+		{
+			name:     "first failure reported",
+			reply:    "No such window found\n\n\nok\n\n\nInvalid dispatcher",
+			wantErrs: []bool{true, false, true},
+			wantErr:  "batch command 0 (/dispatch focuswindow address:0x1) failed: error result: No such window found",
+		},
+		{
+			name:     "missing replies",
+			reply:    "ok",
+			wantErrs: []bool{false, true, true},
+			wantErr:  "batch command 1 (/dispatch bogus) failed: error result: missing reply",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, reqs := fakeSocket(t, tt.reply)
+
+			b := c.Batch()
+			b.Dispatchf("focuswindow address:%s", "0x1")
+			b.Dispatch("bogus")
+			b.SetOption("general:gaps_in", "0")
+
+			results, err := b.Run()
+
+			wantReq := "[[BATCH]]/dispatch focuswindow address:0x1;/dispatch bogus;/keyword general:gaps_in 0"
+			if got := <-reqs; got != wantReq {
+				t.Errorf("request = %q, want %q", got, wantReq)
+			}
+
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Run err = %v, want nil", err)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Run err = %v, want %q", err, tt.wantErr)
+			}
+
+			if len(results) != len(tt.wantErrs) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.wantErrs))
+			}
+			for i, r := range results {
+				if (r.Err != nil) != tt.wantErrs[i] {
+					t.Errorf("result %d (%s) err = %v, want err %t", i, r.Cmd, r.Err, tt.wantErrs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBatchRunEmpty(t *testing.T) {
+	c, reqs := fakeSocket(t, "ok")
+
+	results, err := c.Batch().Run()
+	if results != nil || err != nil {
+		t.Errorf("Run = %v, %v; want nil, nil", results, err)
+	}
+
+	select {
+	case req := <-reqs:
+		t.Errorf("empty batch sent request %q", req)
+	default:
+	}
+}
@@ -0,0 +1,343 @@
+package hyprctl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/psanford/hypr-buddy/config"
+)
+
+// Event is a parsed event from Hyprland's socket2.
+//
+// Window addresses in events are normalized to the "0x..." form used by
+// Window.Address, even though Hyprland sends them without the prefix.
+type Event interface {
+	EventName() string
+}
+
+// RawEvent is returned for events that have no typed representation,
+// or whose data could not be parsed.
+type RawEvent struct {
+	Name string
+	Data string
+}
+
+func (e RawEvent) EventName() string { return e.Name }
+
+type OpenWindowEvent struct {
+	Address   string
+	Workspace string
+	Class     string
+	Title     string
+}
+
+func (e OpenWindowEvent) EventName() string { return "openwindow" }
+
+type CloseWindowEvent struct {
+	Address string
+}
+
+func (e CloseWindowEvent) EventName() string { return "closewindow" }
+
+type MoveWindowEvent struct {
+	Address   string
+	Workspace string
+}
+
+func (e MoveWindowEvent) EventName() string { return "movewindow" }
+
+type MoveWindowV2Event struct {
+	Address       string
+	WorkspaceID   int64
+	WorkspaceName string
+}
+
+func (e MoveWindowV2Event) EventName() string { return "movewindowv2" }
+
+type WorkspaceEvent struct {
+	Name string
+}
+
+func (e WorkspaceEvent) EventName() string { return "workspace" }
+
+type WorkspaceV2Event struct {
+	ID   int64
+	Name string
+}
+
+func (e WorkspaceV2Event) EventName() string { return "workspacev2" }
+
+type FocusedMonEvent struct {
+	Monitor   string
+	Workspace string
+}
+
+func (e FocusedMonEvent) EventName() string { return "focusedmon" }
+
+type ActiveWindowEvent struct {
+	Class string
+	Title string
+}
+
+func (e ActiveWindowEvent) EventName() string { return "activewindow" }
+
+// ActiveWindowV2Event has an empty Address when no window is focused.
+type ActiveWindowV2Event struct {
+	Address string
+}
+
+func (e ActiveWindowV2Event) EventName() string { return "activewindowv2" }
+
+type ChangeFloatingModeEvent struct {
+	Address  string
+	Floating bool
+}
+
+func (e ChangeFloatingModeEvent) EventName() string { return "changefloatingmode" }
+
+type FullscreenEvent struct {
+	Fullscreen bool
+}
+
+func (e FullscreenEvent) EventName() string { return "fullscreen" }
+
+type MonitorAddedEvent struct {
+	Name string
+}
+
+func (e MonitorAddedEvent) EventName() string { return "monitoradded" }
+
+type MonitorAddedV2Event struct {
+	ID          int64
+	Name        string
+	Description string
+}
+
+func (e MonitorAddedV2Event) EventName() string { return "monitoraddedv2" }
+
+type MonitorRemovedEvent struct {
+	Name string
+}
+
+func (e MonitorRemovedEvent) EventName() string { return "monitorremoved" }
+
+type CreateWorkspaceEvent struct {
+	Name string
+}
+
+func (e CreateWorkspaceEvent) EventName() string { return "createworkspace" }
+
+type CreateWorkspaceV2Event struct {
+	ID   int64
+	Name string
+}
+
+func (e CreateWorkspaceV2Event) EventName() string { return "createworkspacev2" }
+
+type DestroyWorkspaceEvent struct {
+	Name string
+}
+
+func (e DestroyWorkspaceEvent) EventName() string { return "destroyworkspace" }
+
+type DestroyWorkspaceV2Event struct {
+	ID   int64
+	Name string
+}
+
+func (e DestroyWorkspaceV2Event) EventName() string { return "destroyworkspacev2" }
+
+type MoveWorkspaceEvent struct {
+	Workspace string
+	Monitor   string
+}
+
+func (e MoveWorkspaceEvent) EventName() string { return "moveworkspace" }
+
+type UrgentEvent struct {
+	Address string
+}
+
+func (e UrgentEvent) EventName() string { return "urgent" }
+
+type WindowTitleEvent struct {
+	Address string
+}
+
+func (e WindowTitleEvent) EventName() string { return "windowtitle" }
+
+type WindowTitleV2Event struct {
+	Address string
+	Title   string
+}
+
+func (e WindowTitleV2Event) EventName() string { return "windowtitlev2" }
+
+type PinEvent struct {
+	Address string
+	Pinned  bool
+}
+
+func (e PinEvent) EventName() string { return "pin" }
+
+// ParseEvent parses a single socket2 line of the form "name>>data".
+// Unknown or malformed events are returned as a RawEvent.
+func ParseEvent(line string) (Event, error) {
+	line = strings.TrimSpace(line)
+	name, data, ok := strings.Cut(line, ">>")
+	if !ok {
+		return nil, fmt.Errorf("malformatted event line: <%s>", line)
+	}
+
+	raw := RawEvent{Name: name, Data: data}
+
+	// fields splits data into exactly n comma separated fields. The last
+	// field keeps any remaining commas since titles may contain them.
+	fields := func(n int) []string {
+		parts := strings.SplitN(data, ",", n)
+		if len(parts) != n {
+			return nil
+		}
+		return parts
+	}
+
+	switch name {
+	case "openwindow":
+		if f := fields(4); f != nil {
+			return OpenWindowEvent{Address: addr(f[0]), Workspace: f[1], Class: f[2], Title: f[3]}, nil
+		}
+	case "closewindow":
+		return CloseWindowEvent{Address: addr(data)}, nil
+	case "movewindow":
+		if f := fields(2); f != nil {
+			return MoveWindowEvent{Address: addr(f[0]), Workspace: f[1]}, nil
+		}
+	case "movewindowv2":
+		if f := fields(3); f != nil {
+			if id, err := strconv.ParseInt(f[1], 10, 64); err == nil {
+				return MoveWindowV2Event{Address: addr(f[0]), WorkspaceID: id, WorkspaceName: f[2]}, nil
+			}
+		}
+	case "workspace":
+		return WorkspaceEvent{Name: data}, nil
+	case "workspacev2":
+		if f := fields(2); f != nil {
+			if id, err := strconv.ParseInt(f[0], 10, 64); err == nil {
+				return WorkspaceV2Event{ID: id, Name: f[1]}, nil
+			}
+		}
+	case "focusedmon":
+		if f := fields(2); f != nil {
+			return FocusedMonEvent{Monitor: f[0], Workspace: f[1]}, nil
+		}
+	case "activewindow":
+		if f := fields(2); f != nil {
+			return ActiveWindowEvent{Class: f[0], Title: f[1]}, nil
+		}
+	case "activewindowv2":
+		return ActiveWindowV2Event{Address: addr(data)}, nil
+	case "changefloatingmode":
+		if f := fields(2); f != nil {
+			return ChangeFloatingModeEvent{Address: addr(f[0]), Floating: f[1] == "1"}, nil
+		}
+	case "fullscreen":
+		return FullscreenEvent{Fullscreen: data == "1"}, nil
+	case "monitoradded":
+		return MonitorAddedEvent{Name: data}, nil
+	case "monitoraddedv2":
+		if f := fields(3); f != nil {
+			if id, err := strconv.ParseInt(f[0], 10, 64); err == nil {
+				return MonitorAddedV2Event{ID: id, Name: f[1], Description: f[2]}, nil
+			}
+		}
+	case "monitorremoved":
+		return MonitorRemovedEvent{Name: data}, nil
+	case "createworkspace":
+		return CreateWorkspaceEvent{Name: data}, nil
+	case "createworkspacev2":
+		if f := fields(2); f != nil {
+			if id, err := strconv.ParseInt(f[0], 10, 64); err == nil {
+				return CreateWorkspaceV2Event{ID: id, Name: f[1]}, nil
+			}
+		}
+	case "destroyworkspace":
+		return DestroyWorkspaceEvent{Name: data}, nil
+	case "destroyworkspacev2":
+		if f := fields(2); f != nil {
+			if id, err := strconv.ParseInt(f[0], 10, 64); err == nil {
+				return DestroyWorkspaceV2Event{ID: id, Name: f[1]}, nil
+			}
+		}
+	case "moveworkspace":
+		if f := fields(2); f != nil {
+			return MoveWorkspaceEvent{Workspace: f[0], Monitor: f[1]}, nil
+		}
+	case "urgent":
+		return UrgentEvent{Address: addr(data)}, nil
+	case "windowtitle":
+		return WindowTitleEvent{Address: addr(data)}, nil
+	case "windowtitlev2":
+		if f := fields(2); f != nil {
+			return WindowTitleV2Event{Address: addr(f[0]), Title: f[1]}, nil
+		}
+	case "pin":
+		if f := fields(2); f != nil {
+			return PinEvent{Address: addr(f[0]), Pinned: f[1] == "1"}, nil
+		}
+	}
+
+	return raw, nil
+}
+
+func addr(a string) string {
+	if a == "" {
+		return ""
+	}
+	return "0x" + a
+}
+
+// EventReader reads typed events from Hyprland's socket2.
+type EventReader struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func NewEventReader() (*EventReader, error) {
+	sig := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	if sig == "" {
+		return nil, errors.New("HYPRLAND_INSTANCE_SIGNATURE not set")
+	}
+
+	path := config.HyprRuntimeDir() + ".socket2.sock"
+	return NewEventReaderFromPath(path)
+}
+
+func NewEventReaderFromPath(path string) (*EventReader, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", path, err)
+	}
+
+	return &EventReader{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}, nil
+}
+
+// Next blocks until the next event arrives.
+func (er *EventReader) Next() (Event, error) {
+	b, err := er.r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	return ParseEvent(string(b))
+}
+
+func (er *EventReader) Close() error {
+	return er.conn.Close()
+}
@@ -0,0 +1,72 @@
+package hyprctl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		line string
+		want Event
+	}{
+		{"openwindow>>5600a0,2,kitty,vim", OpenWindowEvent{Address: "0x5600a0", Workspace: "2", Class: "kitty", Title: "vim"}},
+		{"openwindow>>5600a0,2,firefox,Inbox, 3 unread - Mail", OpenWindowEvent{Address: "0x5600a0", Workspace: "2", Class: "firefox", Title: "Inbox, 3 unread - Mail"}},
+		{"openwindow>>5600a0,2,kitty", RawEvent{Name: "openwindow", Data: "5600a0,2,kitty"}},
+		{"closewindow>>5600a0", CloseWindowEvent{Address: "0x5600a0"}},
+		{"movewindow>>5600a0,special:hidden-1", MoveWindowEvent{Address: "0x5600a0", Workspace: "special:hidden-1"}},
+		{"movewindowv2>>5600a0,-98,special:hidden-1", MoveWindowV2Event{Address: "0x5600a0", WorkspaceID: -98, WorkspaceName: "special:hidden-1"}},
+		{"movewindowv2>>5600a0,x,web", RawEvent{Name: "movewindowv2", Data: "5600a0,x,web"}},
+		{"workspace>>3", WorkspaceEvent{Name: "3"}},
+		{"workspacev2>>-1337,web,mail", WorkspaceV2Event{ID: -1337, Name: "web,mail"}},
+		{"focusedmon>>DP-1,4", FocusedMonEvent{Monitor: "DP-1", Workspace: "4"}},
+		{"activewindow>>kitty,a, b", ActiveWindowEvent{Class: "kitty", Title: "a, b"}},
+		{"activewindow>>,", ActiveWindowEvent{}},
+		{"activewindowv2>>5600a0", ActiveWindowV2Event{Address: "0x5600a0"}},
+		{"activewindowv2>>", ActiveWindowV2Event{}},
+		{"changefloatingmode>>5600a0,1", ChangeFloatingModeEvent{Address: "0x5600a0", Floating: true}},
+		{"changefloatingmode>>5600a0,0", ChangeFloatingModeEvent{Address: "0x5600a0"}},
+		{"fullscreen>>1", FullscreenEvent{Fullscreen: true}},
+		{"fullscreen>>0", FullscreenEvent{}},
+		{"monitoradded>>HDMI-A-1", MonitorAddedEvent{Name: "HDMI-A-1"}},
+		{"monitoraddedv2>>1,HDMI-A-1,Dell Inc. U2720Q, rev 2", MonitorAddedV2Event{ID: 1, Name: "HDMI-A-1", Description: "Dell Inc. U2720Q, rev 2"}},
+		{"monitorremoved>>HDMI-A-1", MonitorRemovedEvent{Name: "HDMI-A-1"}},
+		{"createworkspace>>5", CreateWorkspaceEvent{Name: "5"}},
+		{"createworkspacev2>>5,5", CreateWorkspaceV2Event{ID: 5, Name: "5"}},
+		{"destroyworkspace>>5", DestroyWorkspaceEvent{Name: "5"}},
+		{"destroyworkspacev2>>5,5", DestroyWorkspaceV2Event{ID: 5, Name: "5"}},
+		{"destroyworkspacev2>>5", RawEvent{Name: "destroyworkspacev2", Data: "5"}},
+		{"moveworkspace>>5,DP-2", MoveWorkspaceEvent{Workspace: "5", Monitor: "DP-2"}},
+		{"urgent>>5600a0", UrgentEvent{Address: "0x5600a0"}},
+		{"windowtitle>>5600a0", WindowTitleEvent{Address: "0x5600a0"}},
+		{"windowtitlev2>>5600a0,make: *** [all], Error 2", WindowTitleV2Event{Address: "0x5600a0", Title: "make: *** [all], Error 2"}},
+		{"pin>>5600a0,1", PinEvent{Address: "0x5600a0", Pinned: true}},
+		{"submap>>resize", RawEvent{Name: "submap", Data: "resize"}},
+		{"configreloaded>>", RawEvent{Name: "configreloaded"}},
+		{"activelayout>>kbd,English (US), intl", RawEvent{Name: "activelayout", Data: "kbd,English (US), intl"}},
+		{"workspace>>2\n", WorkspaceEvent{Name: "2"}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseEvent(tt.line)
+		if err != nil {
+			t.Errorf("ParseEvent(%q) err: %s", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseEvent(%q) = %#v, want %#v", tt.line, got, tt.want)
+		}
+		if got.EventName() != tt.want.EventName() {
+			t.Errorf("ParseEvent(%q).EventName() = %q, want %q", tt.line, got.EventName(), tt.want.EventName())
+		}
+	}
+}
+
+func TestParseEventMalformed(t *testing.T) {
+	for _, line := range []string{"", "openwindow", "openwindow 5600a0"} {
+		evt, err := ParseEvent(line)
+		if err == nil {
+			t.Errorf("ParseEvent(%q) = %#v, want error", line, evt)
+		}
+	}
+}
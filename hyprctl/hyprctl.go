@@ -1,14 +1,15 @@
 package hyprctl
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"strconv"
 
 	"github.com/psanford/hypr-buddy/config"
 )
@@ -68,6 +69,30 @@ func (c *Client) ActiveWorkspace() (*Workspace, error) {
 	return &resp, nil
 }
 
+// ActiveWindow returns the focused window. Address is empty if no window
+// has focus.
+func (c *Client) ActiveWindow() (*Window, error) {
+	conn, err := c.conn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", c.p, err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("j/activewindow"))
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(conn)
+	var resp Window
+	err = d.Decode(&resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
 func (c *Client) Workspaces() ([]Workspace, error) {
 	conn, err := c.conn()
 	if err != nil {
@@ -112,6 +137,30 @@ func (c *Client) Monitors() ([]Monitor, error) {
 	return resp, nil
 }
 
+// WorkspaceRules returns the workspace rules from the Hyprland config,
+// e.g. which monitor each workspace is bound to.
+func (c *Client) WorkspaceRules() ([]WorkspaceRule, error) {
+	conn, err := c.conn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", c.p, err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("j/workspacerules"))
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(conn)
+	var resp []WorkspaceRule
+	err = d.Decode(&resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
 func (c *Client) Windows() ([]Window, error) {
 	conn, err := c.conn()
 	if err != nil {
@@ -145,15 +194,7 @@ func (c *Client) DispatchRaw(args string) error {
 	defer conn.Close()
 
 	fmt.Fprintf(conn, "/dispatch %s", args)
-	r := bufio.NewReader(conn)
-	b, err := r.ReadBytes('\n')
-	if err != nil {
-		return err
-	}
-	if !bytes.Equal(b, []byte("ok")) {
-		return fmt.Errorf("error result: %s", b)
-	}
-	return nil
+	return readOK(conn)
 }
 
 func (c *Client) GetOption(opt string) (*Option, error) {
@@ -179,11 +220,17 @@ func (c *Client) SetOption(opt, value string) error {
 	defer conn.Close()
 
 	fmt.Fprintf(conn, "/keyword %s %s", opt, value)
-	r := bufio.NewReader(conn)
-	b, err := r.ReadBytes('\n')
+	return readOK(conn)
+}
+
+// readOK reads a plain text reply. Hyprland writes the reply without a
+// trailing newline and then closes the connection.
+func readOK(conn net.Conn) error {
+	b, err := io.ReadAll(conn)
 	if err != nil {
 		return err
 	}
+	b = bytes.TrimSpace(b)
 	if !bytes.Equal(b, []byte("ok")) {
 		return fmt.Errorf("error result: %s", b)
 	}
@@ -191,12 +238,69 @@ func (c *Client) SetOption(opt, value string) error {
 }
 
 type Option struct {
+	Custom string  `json:"custom,omitempty"`
 	Data   string  `json:"data"`
 	Float  float64 `json:"float"`
 	Int    int64   `json:"int"`
 	Option string  `json:"option"`
 	Set    bool    `json:"set"`
 	Str    string  `json:"str"`
+
+	// Kind is which of the value fields Hyprland reported: "int",
+	// "float", "str", "custom" or "data". Empty if unknown.
+	Kind string `json:"-"`
+}
+
+func (o *Option) UnmarshalJSON(b []byte) error {
+	type plainOption Option
+	var p plainOption
+	err := json.Unmarshal(b, &p)
+	if err != nil {
+		return err
+	}
+	*o = Option(p)
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return err
+	}
+
+	// Hyprland only sends the field that matches the option's type
+	for _, kind := range []string{"custom", "str", "float", "int", "data"} {
+		if _, ok := fields[kind]; ok {
+			o.Kind = kind
+			break
+		}
+	}
+
+	return nil
+}
+
+// Value formats the option so it can be passed back to SetOption.
+func (o *Option) Value() string {
+	switch o.Kind {
+	case "custom":
+		return o.Custom
+	case "str":
+		return o.Str
+	case "data":
+		return o.Data
+	case "float":
+		return strconv.FormatFloat(o.Float, 'f', -1, 64)
+	case "int":
+		return strconv.FormatInt(o.Int, 10)
+	}
+
+	switch {
+	case o.Custom != "":
+		return o.Custom
+	case o.Str != "":
+		return o.Str
+	case o.Float != 0:
+		return strconv.FormatFloat(o.Float, 'f', -1, 64)
+	}
+	return strconv.FormatInt(o.Int, 10)
 }
 
 type Workspace struct {
@@ -210,6 +314,13 @@ type Workspace struct {
 	Windows         int64  `json:"windows"`
 }
 
+type WorkspaceRule struct {
+	WorkspaceString string `json:"workspaceString"`
+	Monitor         string `json:"monitor"`
+	Default         bool   `json:"default"`
+	Persistent      bool   `json:"persistent"`
+}
+
 type Window struct {
 	Address        string        `json:"address"`
 	At             []int64       `json:"at"`
@@ -0,0 +1,319 @@
+// Package hyprtest provides a fake Hyprland instance for hermetic tests.
+//
+// A Server listens on the same .socket.sock and .socket2.sock paths that a
+// real compositor would, keeps an in-memory model of monitors, workspaces and
+// clients, applies /dispatch commands to that model and emits the matching
+// socket2 events.
+package hyprtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+type Server struct {
+	dir string
+	sig string
+
+	reqL net.Listener
+	evtL net.Listener
+
+	// OnExec, if set, is called from its own goroutine for every
+	// "exec" dispatch.
+	OnExec func(cmd string)
+
+	mu sync.Mutex
+
+	monitors     []*monitor
+	workspaces   []*workspace
+	windows      []*window
+	focusHistory []*window
+	activeWin    *window
+	focusedMon   *monitor
+
+	nextAddr      uint64
+	nextSpecialID int64
+	nextNamedID   int64
+
+	options  map[string]hyprctl.Option
+	rules    []hyprctl.WorkspaceRule
+	requests []string
+
+	subs   map[*subscriber]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewServer starts a fake Hyprland instance in a fresh temporary
+// runtime directory with a single 1920x1080 monitor showing workspace 1.
+// Call Close when done.
+func NewServer() *Server {
+	s, err := newServer()
+	if err != nil {
+		panic(fmt.Sprintf("hyprtest: failed to start server: %s", err))
+	}
+	return s
+}
+
+func newServer() (*Server, error) {
+	dir, err := os.MkdirTemp("", "hyprtest")
+	if err != nil {
+		return nil, err
+	}
+
+	var rnd [6]byte
+	rand.Read(rnd[:])
+	sig := "hyprtest_" + hex.EncodeToString(rnd[:])
+
+	sockDir := filepath.Join(dir, "hypr", sig)
+	err = os.MkdirAll(sockDir, 0700)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	s := &Server{
+		dir:           dir,
+		sig:           sig,
+		nextAddr:      0x5600000000,
+		nextSpecialID: -99,
+		nextNamedID:   -1337,
+		options:       make(map[string]hyprctl.Option),
+		subs:          make(map[*subscriber]struct{}),
+	}
+
+	s.reqL, err = net.Listen("unix", filepath.Join(sockDir, ".socket.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	s.evtL, err = net.Listen("unix", filepath.Join(sockDir, ".socket2.sock"))
+	if err != nil {
+		s.reqL.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	s.AddMonitor(MonitorSpec{Name: "DP-1", Width: 1920, Height: 1080})
+
+	for name, val := range defaultOptions {
+		s.options[name] = parseOption(name, val)
+	}
+
+	s.wg.Add(2)
+	go s.acceptRequests()
+	go s.acceptEventSubscribers()
+
+	return s, nil
+}
+
+// RuntimeDir is the value XDG_RUNTIME_DIR must have for
+// config.HyprRuntimeDir to resolve to this server.
+func (s *Server) RuntimeDir() string {
+	return s.dir
+}
+
+// Signature is the fake HYPRLAND_INSTANCE_SIGNATURE.
+func (s *Server) Signature() string {
+	return s.sig
+}
+
+// SocketPath is the path of the request socket (.socket.sock).
+func (s *Server) SocketPath() string {
+	return filepath.Join(s.dir, "hypr", s.sig, ".socket.sock")
+}
+
+// EventSocketPath is the path of the event socket (.socket2.sock).
+func (s *Server) EventSocketPath() string {
+	return filepath.Join(s.dir, "hypr", s.sig, ".socket2.sock")
+}
+
+// Setenv points hyprctl.New, the hypr-buddy daemon and its client at this
+// server for the duration of the test.
+func (s *Server) Setenv(tb testing.TB) {
+	tb.Setenv("XDG_RUNTIME_DIR", s.dir)
+	tb.Setenv("HYPRLAND_INSTANCE_SIGNATURE", s.sig)
+	tb.Setenv("HYPRBUDDY_SOCKET", filepath.Join(s.dir, "hypr-buddy.control.sock"))
+	tb.Setenv("XDG_STATE_HOME", filepath.Join(s.dir, "state"))
+	tb.Setenv("XDG_CONFIG_HOME", filepath.Join(s.dir, "config"))
+}
+
+// Client returns a hyprctl client connected to this server.
+func (s *Server) Client() *hyprctl.Client {
+	c, err := hyprctl.NewFromPath(s.SocketPath())
+	if err != nil {
+		panic(fmt.Sprintf("hyprtest: %s", err))
+	}
+	return c
+}
+
+// Requests returns every raw request received on the request socket,
+// in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Close stops the server, disconnects all event subscribers and removes
+// the runtime directory.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for sub := range s.subs {
+		sub.close()
+	}
+	s.mu.Unlock()
+
+	s.reqL.Close()
+	s.evtL.Close()
+	s.wg.Wait()
+	os.RemoveAll(s.dir)
+}
+
+func (s *Server) acceptRequests() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.reqL.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveRequest(conn)
+	}
+}
+
+func (s *Server) serveRequest(conn net.Conn) {
+	defer conn.Close()
+
+	// Hyprland reads a single message per connection, writes its reply
+	// and then closes the socket.
+	buf := make([]byte, 8192)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return
+	}
+
+	resp := s.handleRequest(string(buf[:n]))
+	conn.Write([]byte(resp))
+}
+
+func (s *Server) acceptEventSubscribers() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.evtL.Accept()
+		if err != nil {
+			return
+		}
+
+		sub := &subscriber{
+			conn: conn,
+			wake: make(chan struct{}, 1),
+			done: make(chan struct{}),
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.subs[sub] = struct{}{}
+		s.mu.Unlock()
+
+		go func() {
+			sub.run()
+			s.mu.Lock()
+			delete(s.subs, sub)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Emit sends a raw event to every socket2 subscriber.
+func (s *Server) Emit(name, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emit(name, data)
+}
+
+// emit must be called with s.mu held, which keeps event order consistent
+// with the order of model changes.
+func (s *Server) emit(name, data string) {
+	line := name + ">>" + data + "\n"
+	for sub := range s.subs {
+		sub.push(line)
+	}
+}
+
+type subscriber struct {
+	conn net.Conn
+
+	mu    sync.Mutex
+	queue []string
+	wake  chan struct{}
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (sub *subscriber) push(line string) {
+	sub.mu.Lock()
+	sub.queue = append(sub.queue, line)
+	sub.mu.Unlock()
+
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *subscriber) close() {
+	sub.closeOnce.Do(func() {
+		close(sub.done)
+		sub.conn.Close()
+	})
+}
+
+func (sub *subscriber) run() {
+	defer sub.close()
+	for {
+		select {
+		case <-sub.wake:
+		case <-sub.done:
+			return
+		}
+
+		sub.mu.Lock()
+		pending := sub.queue
+		sub.queue = nil
+		sub.mu.Unlock()
+
+		_, err := sub.conn.Write([]byte(strings.Join(pending, "")))
+		if err != nil {
+			return
+		}
+	}
+}
+
+var defaultOptions = map[string]string{
+	"animations:enabled":  "1",
+	"general:gaps_in":     "5",
+	"general:gaps_out":    "20",
+	"decoration:rounding": "10",
+}
+
+var errNoWindow = errors.New("No such window found")
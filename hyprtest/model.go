@@ -0,0 +1,1105 @@
+package hyprtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+type MonitorSpec struct {
+	Name   string
+	Width  int64
+	Height int64
+	// Scale defaults to 1
+	Scale float64
+	X     int64
+	Y     int64
+	// Reserved is left, top, right, bottom
+	Reserved [4]int64
+}
+
+type WindowSpec struct {
+	Class string
+	Title string
+	// Workspace is a workspace selector such as "2", "name:web" or
+	// "special:foo". Empty means the focused workspace.
+	Workspace string
+	Floating  bool
+	Pid       int64
+	Xwayland  bool
+}
+
+type monitor struct {
+	id       int64
+	spec     MonitorSpec
+	activeWS *workspace
+}
+
+type workspace struct {
+	id   int64
+	name string
+	mon  *monitor
+
+	masterCount int
+	orientation string
+	// mfact is the fraction of the workspace given to the masters
+	mfact float64
+}
+
+func (ws *workspace) special() bool {
+	return strings.HasPrefix(ws.name, "special:")
+}
+
+type window struct {
+	addr         uint64
+	class        string
+	title        string
+	initialClass string
+	initialTitle string
+	pid          int64
+	xwayland     bool
+	floating     bool
+	pinned       bool
+	fullscreen   bool
+	ws           *workspace
+
+	// geometry of floating windows; tiled windows are laid out on demand
+	at   [2]int64
+	size [2]int64
+}
+
+type rect struct {
+	x, y, w, h int64
+}
+
+// AddMonitor attaches a new monitor showing the lowest unused numeric
+// workspace. The first monitor added becomes the focused monitor.
+func (s *Server) AddMonitor(spec MonitorSpec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if spec.Scale == 0 {
+		spec.Scale = 1
+	}
+
+	m := &monitor{
+		id:   int64(len(s.monitors)),
+		spec: spec,
+	}
+	s.monitors = append(s.monitors, m)
+	s.emit("monitoradded", spec.Name)
+	s.emit("monitoraddedv2", fmt.Sprintf("%d,%s,%s", m.id, spec.Name, spec.Name))
+
+	var id int64 = 1
+	for s.workspaceByID(id) != nil {
+		id++
+	}
+	m.activeWS = s.createWorkspace(id, strconv.FormatInt(id, 10), m)
+
+	if s.focusedMon == nil {
+		s.focusedMon = m
+	}
+}
+
+// AddWorkspaceRule adds a rule to what j/workspacerules reports. Rules
+// are informational only; they do not affect where workspaces are
+// created.
+func (s *Server) AddWorkspaceRule(rule hyprctl.WorkspaceRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, rule)
+}
+
+// OpenWindow maps a new client and returns its address in the "0x..."
+// form used by j/clients. The window is focused if it opens on the
+// focused workspace.
+func (s *Server) OpenWindow(spec WindowSpec) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ws := s.focusedMon.activeWS
+	if spec.Workspace != "" {
+		var err error
+		ws, err = s.resolveWorkspace(spec.Workspace)
+		if err != nil {
+			panic(fmt.Sprintf("hyprtest: OpenWindow: %s", err))
+		}
+	}
+
+	s.nextAddr += 0x10
+	w := &window{
+		addr:         s.nextAddr,
+		class:        spec.Class,
+		title:        spec.Title,
+		initialClass: spec.Class,
+		initialTitle: spec.Title,
+		pid:          spec.Pid,
+		xwayland:     spec.Xwayland,
+		floating:     spec.Floating,
+		ws:           ws,
+	}
+	if w.floating {
+		w.size = [2]int64{800, 600}
+		w.at = s.centeredAt(ws, w.size)
+	}
+	s.windows = append(s.windows, w)
+	if !w.floating {
+		s.insertAsMaster(w)
+	}
+
+	s.emit("openwindow", fmt.Sprintf("%x,%s,%s,%s", w.addr, ws.name, w.class, w.title))
+
+	if ws == s.focusedMon.activeWS {
+		s.focus(w)
+	}
+
+	return formatAddr(w.addr)
+}
+
+// CloseWindow unmaps the client with the given address.
+func (s *Server) CloseWindow(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.windowByAddr(addr)
+	if w == nil {
+		return errNoWindow
+	}
+	s.closeWindow(w)
+	return nil
+}
+
+// SetTitle changes a client's title and emits the windowtitle events.
+func (s *Server) SetTitle(addr, title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.windowByAddr(addr)
+	if w == nil {
+		return errNoWindow
+	}
+	w.title = title
+	s.emit("windowtitle", fmt.Sprintf("%x", w.addr))
+	s.emit("windowtitlev2", fmt.Sprintf("%x,%s", w.addr, w.title))
+	return nil
+}
+
+// Dispatch runs a dispatcher as if triggered by a Hyprland keybind,
+// without recording it in Requests. It returns Hyprland's reply.
+func (s *Server) Dispatch(args string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dispatch(args)
+}
+
+// Windows returns the current clients as j/clients would.
+func (s *Server) Windows() []hyprctl.Window {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clientsJSON()
+}
+
+// Window returns a single client by address.
+func (s *Server) Window(addr string) (hyprctl.Window, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, w := range s.clientsJSON() {
+		if w.Address == addr {
+			return w, true
+		}
+	}
+	return hyprctl.Window{}, false
+}
+
+// Workspaces returns the current workspaces as j/workspaces would.
+func (s *Server) Workspaces() []hyprctl.Workspace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.workspacesJSON()
+}
+
+// ActiveWindow returns the address of the focused client, or "" if
+// nothing is focused.
+func (s *Server) ActiveWindow() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.activeWin == nil {
+		return ""
+	}
+	return formatAddr(s.activeWin.addr)
+}
+
+func (s *Server) handleRequest(req string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	return s.processRequest(req)
+}
+
+func (s *Server) processRequest(req string) string {
+	if batch, ok := strings.CutPrefix(req, "[[BATCH]]"); ok {
+		var replies []string
+		for _, cmd := range strings.Split(batch, ";") {
+			cmd = strings.TrimSpace(cmd)
+			if cmd == "" {
+				continue
+			}
+			replies = append(replies, s.processRequest(cmd))
+		}
+		return strings.Join(replies, "\n\n\n")
+	}
+
+	flags, rest, ok := strings.Cut(req, "/")
+	if !ok {
+		flags, rest = "", req
+	}
+	jsonOut := strings.Contains(flags, "j")
+
+	cmd, args, _ := strings.Cut(rest, " ")
+	switch cmd {
+	case "dispatch":
+		return s.dispatch(args)
+	case "keyword":
+		name, val, _ := strings.Cut(strings.TrimSpace(args), " ")
+		s.options[name] = parseOption(name, strings.TrimSpace(val))
+		return "ok"
+	}
+
+	if !jsonOut {
+		return "hyprtest only supports json output for " + cmd
+	}
+
+	switch cmd {
+	case "clients":
+		return encodeJSON(s.clientsJSON())
+	case "workspaces":
+		return encodeJSON(s.workspacesJSON())
+	case "activeworkspace":
+		ws := s.focusedMon.activeWS
+		for _, info := range s.workspacesJSON() {
+			if info.ID == ws.id {
+				return encodeJSON(info)
+			}
+		}
+	case "monitors":
+		return encodeJSON(s.monitorsJSON())
+	case "activewindow":
+		if s.activeWin == nil {
+			return "{}"
+		}
+		for _, w := range s.clientsJSON() {
+			if w.Address == formatAddr(s.activeWin.addr) {
+				return encodeJSON(w)
+			}
+		}
+	case "workspacerules":
+		return encodeJSON(append([]hyprctl.WorkspaceRule{}, s.rules...))
+	case "getoption":
+		opt, ok := s.options[strings.TrimSpace(args)]
+		if !ok {
+			return "no such option"
+		}
+		// like Hyprland, only include the field for the option's type
+		out := map[string]interface{}{
+			"option": opt.Option,
+			"set":    opt.Set,
+		}
+		switch opt.Kind {
+		case "float":
+			out["float"] = opt.Float
+		case "str":
+			out["str"] = opt.Str
+		default:
+			out["int"] = opt.Int
+		}
+		return encodeJSON(out)
+	}
+
+	return "unknown request"
+}
+
+func (s *Server) dispatch(args string) string {
+	name, arg, _ := strings.Cut(strings.TrimSpace(args), " ")
+	arg = strings.TrimSpace(arg)
+
+	var err error
+	switch name {
+	case "workspace":
+		var ws *workspace
+		ws, err = s.resolveWorkspace(arg)
+		if err == nil {
+			s.showWorkspace(ws)
+		}
+	case "movetoworkspace", "movetoworkspacesilent":
+		wsSel, winSel, _ := strings.Cut(arg, ",")
+		var (
+			w  *window
+			ws *workspace
+		)
+		w, err = s.resolveWindow(winSel)
+		if err != nil {
+			break
+		}
+		ws, err = s.resolveWorkspace(wsSel)
+		if err != nil {
+			break
+		}
+		s.moveToWorkspace(w, ws, name == "movetoworkspacesilent")
+	case "focuswindow":
+		var w *window
+		w, err = s.resolveWindow(arg)
+		if err != nil {
+			break
+		}
+		if !w.ws.special() && w.ws.mon.activeWS != w.ws {
+			s.showWorkspace(w.ws)
+		}
+		s.focus(w)
+	case "layoutmsg":
+		err = s.layoutMsg(arg)
+	case "togglefloating", "setfloating", "settiled":
+		var w *window
+		w, err = s.resolveWindow(arg)
+		if err != nil {
+			break
+		}
+		floating := !w.floating
+		if name == "setfloating" {
+			floating = true
+		} else if name == "settiled" {
+			floating = false
+		}
+		s.setFloating(w, floating)
+	case "movewindowpixel", "resizewindowpixel":
+		params, winSel, _ := strings.Cut(arg, ",")
+		var w *window
+		w, err = s.resolveWindow(winSel)
+		if err != nil {
+			break
+		}
+		err = s.pixelOp(w, name, params)
+	case "centerwindow":
+		w := s.activeWin
+		if w != nil && w.floating {
+			w.at = s.centeredAt(w.ws, w.size)
+		}
+	case "pin":
+		var w *window
+		w, err = s.resolveWindow(arg)
+		if err != nil {
+			break
+		}
+		w.pinned = !w.pinned
+		s.emit("pin", fmt.Sprintf("%x,%d", w.addr, boolInt(w.pinned)))
+	case "fullscreen":
+		w := s.activeWin
+		if w != nil {
+			w.fullscreen = !w.fullscreen
+			s.emit("fullscreen", strconv.Itoa(boolInt(w.fullscreen)))
+		}
+	case "closewindow", "killactive":
+		var w *window
+		w, err = s.resolveWindow(arg)
+		if err != nil {
+			break
+		}
+		s.closeWindow(w)
+	case "exec":
+		if s.OnExec != nil {
+			go s.OnExec(arg)
+		}
+	case "forcerendererreload":
+	default:
+		return "Invalid dispatcher"
+	}
+
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+func (s *Server) layoutMsg(arg string) error {
+	msg, param, _ := strings.Cut(arg, " ")
+	param = strings.TrimSpace(param)
+
+	ws := s.focusedMon.activeWS
+	if s.activeWin != nil {
+		ws = s.activeWin.ws
+	}
+	tiled := s.tiled(ws)
+
+	idx := -1
+	for i, w := range tiled {
+		if w == s.activeWin {
+			idx = i
+		}
+	}
+
+	switch msg {
+	case "swapprev", "swapnext":
+		if idx < 0 || len(tiled) < 2 {
+			return nil
+		}
+		other := idx - 1
+		if msg == "swapnext" {
+			other = idx + 1
+		}
+		other = (other + len(tiled)) % len(tiled)
+		s.swapWindows(tiled[idx], tiled[other])
+	case "cyclenext", "cycleprev":
+		if len(tiled) == 0 {
+			return nil
+		}
+		next := idx + 1
+		if msg == "cycleprev" {
+			next = idx - 1
+		}
+		next = (next + len(tiled)) % len(tiled)
+		s.focus(tiled[next])
+	case "swapwithmaster":
+		if idx < 0 || len(tiled) < 2 {
+			return nil
+		}
+		if idx == 0 {
+			s.swapWindows(tiled[0], tiled[1])
+		} else {
+			s.swapWindows(tiled[0], tiled[idx])
+		}
+	case "addmaster":
+		if ws.masterCount < len(tiled) {
+			ws.masterCount++
+		}
+	case "removemaster":
+		if ws.masterCount > 1 {
+			ws.masterCount--
+		}
+	case "mfact":
+		v := ws.mfact
+		if rest, ok := strings.CutPrefix(param, "exact "); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(rest), 64)
+			if err != nil {
+				return err
+			}
+			v = f
+		} else {
+			f, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return err
+			}
+			v += f
+		}
+		ws.mfact = min(max(v, 0.05), 0.95)
+	case "orientationleft", "orientationright", "orientationtop", "orientationbottom", "orientationcenter":
+		ws.orientation = strings.TrimPrefix(msg, "orientation")
+	default:
+		return fmt.Errorf("unknown layoutmsg %q", msg)
+	}
+	return nil
+}
+
+func (s *Server) pixelOp(w *window, name, params string) error {
+	f := strings.Fields(params)
+	exact := len(f) > 0 && f[0] == "exact"
+	if exact {
+		f = f[1:]
+	}
+	if len(f) != 2 {
+		return fmt.Errorf("invalid %s params %q", name, params)
+	}
+	a, err := strconv.ParseInt(f[0], 10, 64)
+	if err != nil {
+		return err
+	}
+	b, err := strconv.ParseInt(f[1], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	if !w.floating {
+		// tiled windows are positioned by the layout
+		return nil
+	}
+
+	target := &w.at
+	if name == "resizewindowpixel" {
+		target = &w.size
+	}
+	if exact {
+		*target = [2]int64{a, b}
+	} else {
+		target[0] += a
+		target[1] += b
+	}
+	return nil
+}
+
+func (s *Server) resolveWindow(sel string) (*window, error) {
+	sel = strings.TrimSpace(sel)
+	if sel == "" {
+		if s.activeWin == nil {
+			return nil, errNoWindow
+		}
+		return s.activeWin, nil
+	}
+
+	kind, val, _ := strings.Cut(sel, ":")
+	switch kind {
+	case "address":
+		w := s.windowByAddr(val)
+		if w == nil {
+			return nil, errNoWindow
+		}
+		return w, nil
+	case "class", "title":
+		re, err := regexp.Compile(val)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range s.windows {
+			if (kind == "class" && re.MatchString(w.class)) || (kind == "title" && re.MatchString(w.title)) {
+				return w, nil
+			}
+		}
+	}
+	return nil, errNoWindow
+}
+
+// resolveWorkspace looks up a workspace selector, creating the workspace
+// on the focused monitor if it does not exist yet.
+func (s *Server) resolveWorkspace(sel string) (*workspace, error) {
+	sel = strings.TrimSpace(sel)
+	if sel == "" {
+		return nil, fmt.Errorf("Invalid workspace")
+	}
+
+	switch {
+	case sel == "special" || strings.HasPrefix(sel, "special:"):
+		name := sel
+		if name == "special" {
+			name = "special:special"
+		}
+		if ws := s.workspaceByName(name); ws != nil {
+			return ws, nil
+		}
+		id := s.nextSpecialID
+		s.nextSpecialID--
+		return s.createWorkspace(id, name, s.focusedMon), nil
+	case strings.HasPrefix(sel, "name:"):
+		name := strings.TrimPrefix(sel, "name:")
+		if ws := s.workspaceByName(name); ws != nil {
+			return ws, nil
+		}
+		id := s.nextNamedID
+		s.nextNamedID--
+		return s.createWorkspace(id, name, s.focusedMon), nil
+	}
+
+	id, err := strconv.ParseInt(sel, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid workspace")
+	}
+	if sel[0] == '+' || sel[0] == '-' {
+		id += s.focusedMon.activeWS.id
+	}
+	if id < 1 {
+		return nil, fmt.Errorf("Invalid workspace")
+	}
+	if ws := s.workspaceByID(id); ws != nil {
+		return ws, nil
+	}
+	return s.createWorkspace(id, strconv.FormatInt(id, 10), s.focusedMon), nil
+}
+
+func (s *Server) createWorkspace(id int64, name string, mon *monitor) *workspace {
+	ws := &workspace{
+		id:          id,
+		name:        name,
+		mon:         mon,
+		masterCount: 1,
+		orientation: "left",
+		mfact:       0.55,
+	}
+	s.workspaces = append(s.workspaces, ws)
+	s.emit("createworkspace", name)
+	s.emit("createworkspacev2", fmt.Sprintf("%d,%s", id, name))
+	return ws
+}
+
+// cleanupWorkspaces destroys workspaces that are empty and not shown on
+// any monitor, as Hyprland does.
+func (s *Server) cleanupWorkspaces() {
+	kept := s.workspaces[:0]
+	for _, ws := range s.workspaces {
+		if ws.mon.activeWS == ws || len(s.windowsOn(ws)) > 0 {
+			kept = append(kept, ws)
+			continue
+		}
+		s.emit("destroyworkspace", ws.name)
+		s.emit("destroyworkspacev2", fmt.Sprintf("%d,%s", ws.id, ws.name))
+	}
+	s.workspaces = kept
+}
+
+func (s *Server) showWorkspace(ws *workspace) {
+	if ws.special() {
+		// special workspaces are never the active workspace of a monitor
+		return
+	}
+
+	mon := ws.mon
+	if s.focusedMon != mon {
+		s.focusedMon = mon
+		s.emit("focusedmon", fmt.Sprintf("%s,%s", mon.spec.Name, ws.name))
+	}
+	if mon.activeWS != ws {
+		mon.activeWS = ws
+		s.emit("workspace", ws.name)
+		s.emit("workspacev2", fmt.Sprintf("%d,%s", ws.id, ws.name))
+	}
+	s.refocus()
+	s.cleanupWorkspaces()
+}
+
+func (s *Server) moveToWorkspace(w *window, ws *workspace, silent bool) {
+	if w.ws == ws {
+		return
+	}
+	from := w.ws
+	w.ws = ws
+	s.clampMasters(from)
+	if !w.floating {
+		s.insertAsMaster(w)
+	}
+
+	s.emit("movewindow", fmt.Sprintf("%x,%s", w.addr, ws.name))
+	s.emit("movewindowv2", fmt.Sprintf("%x,%d,%s", w.addr, ws.id, ws.name))
+
+	if silent {
+		s.refocus()
+	} else {
+		s.showWorkspace(ws)
+		s.focus(w)
+	}
+	s.cleanupWorkspaces()
+}
+
+func (s *Server) setFloating(w *window, floating bool) {
+	if w.floating == floating {
+		return
+	}
+	if floating {
+		r := s.layout(w.ws)[w]
+		w.at = [2]int64{r.x, r.y}
+		w.size = [2]int64{r.w, r.h}
+	}
+	w.floating = floating
+	if !floating {
+		s.insertAsMaster(w)
+	}
+	s.emit("changefloatingmode", fmt.Sprintf("%x,%d", w.addr, boolInt(floating)))
+}
+
+func (s *Server) closeWindow(w *window) {
+	for i, other := range s.windows {
+		if other == w {
+			s.windows = append(s.windows[:i], s.windows[i+1:]...)
+			break
+		}
+	}
+	for i, other := range s.focusHistory {
+		if other == w {
+			s.focusHistory = append(s.focusHistory[:i], s.focusHistory[i+1:]...)
+			break
+		}
+	}
+
+	s.clampMasters(w.ws)
+	s.emit("closewindow", fmt.Sprintf("%x", w.addr))
+
+	if s.activeWin == w {
+		s.activeWin = nil
+	}
+	s.refocus()
+	s.cleanupWorkspaces()
+}
+
+func (s *Server) focus(w *window) {
+	if w == s.activeWin {
+		return
+	}
+	s.activeWin = w
+	if w == nil {
+		s.emit("activewindow", ",")
+		s.emit("activewindowv2", "")
+		return
+	}
+
+	history := []*window{w}
+	for _, other := range s.focusHistory {
+		if other != w {
+			history = append(history, other)
+		}
+	}
+	s.focusHistory = history
+
+	s.emit("activewindow", fmt.Sprintf("%s,%s", w.class, w.title))
+	s.emit("activewindowv2", fmt.Sprintf("%x", w.addr))
+}
+
+// refocus moves focus to the most recently used window on the focused
+// workspace if the active window is no longer visible there.
+func (s *Server) refocus() {
+	ws := s.focusedMon.activeWS
+	if s.activeWin != nil && s.activeWin.ws == ws {
+		return
+	}
+	for _, w := range s.focusHistory {
+		if w.ws == ws {
+			s.focus(w)
+			return
+		}
+	}
+	for _, w := range s.windows {
+		if w.ws == ws {
+			s.focus(w)
+			return
+		}
+	}
+	s.focus(nil)
+}
+
+// insertAsMaster moves w ahead of every other tiled window on its
+// workspace, matching the master layout's new_is_master behavior.
+func (s *Server) insertAsMaster(w *window) {
+	rest := make([]*window, 0, len(s.windows))
+	for _, other := range s.windows {
+		if other != w {
+			rest = append(rest, other)
+		}
+	}
+
+	idx := len(rest)
+	for i, other := range rest {
+		if other.ws == w.ws && !other.floating {
+			idx = i
+			break
+		}
+	}
+
+	s.windows = append(rest[:idx], append([]*window{w}, rest[idx:]...)...)
+}
+
+func (s *Server) swapWindows(a, b *window) {
+	var ai, bi int
+	for i, w := range s.windows {
+		if w == a {
+			ai = i
+		}
+		if w == b {
+			bi = i
+		}
+	}
+	s.windows[ai], s.windows[bi] = s.windows[bi], s.windows[ai]
+}
+
+// clampMasters keeps ws from having more masters than tiled windows, as
+// Hyprland's masters are a flag on each window.
+func (s *Server) clampMasters(ws *workspace) {
+	ws.masterCount = min(ws.masterCount, max(len(s.tiled(ws)), 1))
+}
+
+func (s *Server) tiled(ws *workspace) []*window {
+	var out []*window
+	for _, w := range s.windows {
+		if w.ws == ws && !w.floating {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func (s *Server) windowsOn(ws *workspace) []*window {
+	var out []*window
+	for _, w := range s.windows {
+		if w.ws == ws {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func (s *Server) usableArea(mon *monitor) rect {
+	spec := mon.spec
+	return rect{
+		x: spec.X + spec.Reserved[0],
+		y: spec.Y + spec.Reserved[1],
+		w: int64(float64(spec.Width)/spec.Scale) - spec.Reserved[0] - spec.Reserved[2],
+		h: int64(float64(spec.Height)/spec.Scale) - spec.Reserved[1] - spec.Reserved[3],
+	}
+}
+
+func (s *Server) centeredAt(ws *workspace, size [2]int64) [2]int64 {
+	area := s.usableArea(ws.mon)
+	return [2]int64{area.x + (area.w-size[0])/2, area.y + (area.h-size[1])/2}
+}
+
+// layout computes the geometry of the tiled windows on ws using a
+// gapless master layout in the workspace's orientation. For center the
+// stack alternates right and left of the masters.
+func (s *Server) layout(ws *workspace) map[*window]rect {
+	out := make(map[*window]rect)
+	tiled := s.tiled(ws)
+	if len(tiled) == 0 {
+		return out
+	}
+
+	area := s.usableArea(ws.mon)
+	m := min(max(ws.masterCount, 1), len(tiled))
+	masters, stack := tiled[:m], tiled[m:]
+
+	horizontal := ws.orientation == "top" || ws.orientation == "bottom"
+
+	split := func(wins []*window, r rect, sideBySide bool) {
+		n := int64(len(wins))
+		for i, w := range wins {
+			i := int64(i)
+			if sideBySide {
+				out[w] = rect{r.x + i*r.w/n, r.y, r.w / n, r.h}
+			} else {
+				out[w] = rect{r.x, r.y + i*r.h/n, r.w, r.h / n}
+			}
+		}
+	}
+
+	if len(stack) == 0 {
+		split(masters, area, horizontal)
+		return out
+	}
+
+	switch ws.orientation {
+	case "top", "bottom":
+		mh := int64(float64(area.h) * ws.mfact)
+		masterR := rect{area.x, area.y, area.w, mh}
+		stackR := rect{area.x, area.y + mh, area.w, area.h - mh}
+		if ws.orientation == "bottom" {
+			stackR = rect{area.x, area.y, area.w, area.h - mh}
+			masterR = rect{area.x, area.y + area.h - mh, area.w, mh}
+		}
+		split(masters, masterR, true)
+		split(stack, stackR, true)
+	case "center":
+		if len(stack) > 1 {
+			mw := int64(float64(area.w) * ws.mfact)
+			side := (area.w - mw) / 2
+			split(masters, rect{area.x + side, area.y, mw, area.h}, false)
+
+			var left, right []*window
+			for i, w := range stack {
+				if i%2 == 0 {
+					right = append(right, w)
+				} else {
+					left = append(left, w)
+				}
+			}
+			split(left, rect{area.x, area.y, side, area.h}, false)
+			split(right, rect{area.x + side + mw, area.y, area.w - side - mw, area.h}, false)
+			break
+		}
+		fallthrough
+	default:
+		mw := int64(float64(area.w) * ws.mfact)
+		masterR := rect{area.x, area.y, mw, area.h}
+		stackR := rect{area.x + mw, area.y, area.w - mw, area.h}
+		if ws.orientation == "right" {
+			stackR = rect{area.x, area.y, area.w - mw, area.h}
+			masterR = rect{area.x + area.w - mw, area.y, mw, area.h}
+		}
+		split(masters, masterR, false)
+		split(stack, stackR, false)
+	}
+
+	return out
+}
+
+func (s *Server) clientsJSON() []hyprctl.Window {
+	layouts := make(map[*workspace]map[*window]rect)
+	out := make([]hyprctl.Window, 0, len(s.windows))
+	for _, w := range s.windows {
+		at, size := w.at, w.size
+		if !w.floating {
+			l, ok := layouts[w.ws]
+			if !ok {
+				l = s.layout(w.ws)
+				layouts[w.ws] = l
+			}
+			r := l[w]
+			at = [2]int64{r.x, r.y}
+			size = [2]int64{r.w, r.h}
+		}
+
+		focusID := int64(-1)
+		for i, other := range s.focusHistory {
+			if other == w {
+				focusID = int64(i)
+			}
+		}
+
+		hw := hyprctl.Window{
+			Address:        formatAddr(w.addr),
+			At:             at[:],
+			Class:          w.class,
+			Floating:       w.floating,
+			FocusHistoryID: focusID,
+			Fullscreen:     w.fullscreen,
+			Grouped:        []interface{}{},
+			InitialClass:   w.initialClass,
+			InitialTitle:   w.initialTitle,
+			Mapped:         true,
+			Monitor:        w.ws.mon.id,
+			Pid:            w.pid,
+			Pinned:         w.pinned,
+			Size:           size[:],
+			Title:          w.title,
+			Xwayland:       w.xwayland,
+		}
+		hw.Workspace.ID = w.ws.id
+		hw.Workspace.Name = w.ws.name
+		out = append(out, hw)
+	}
+	return out
+}
+
+func (s *Server) workspacesJSON() []hyprctl.Workspace {
+	out := make([]hyprctl.Workspace, 0, len(s.workspaces))
+	for _, ws := range s.workspaces {
+		info := hyprctl.Workspace{
+			ID:        ws.id,
+			Name:      ws.name,
+			Monitor:   ws.mon.spec.Name,
+			MonitorID: ws.mon.id,
+			Windows:   int64(len(s.windowsOn(ws))),
+		}
+		for _, w := range s.windowsOn(ws) {
+			if w.fullscreen {
+				info.HasFullScreen = true
+			}
+		}
+		for _, w := range s.focusHistory {
+			if w.ws == ws {
+				info.LastWindow = formatAddr(w.addr)
+				info.LastWindowTitle = w.title
+				break
+			}
+		}
+		out = append(out, info)
+	}
+	return out
+}
+
+func (s *Server) monitorsJSON() []hyprctl.Monitor {
+	out := make([]hyprctl.Monitor, 0, len(s.monitors))
+	for _, m := range s.monitors {
+		hm := hyprctl.Monitor{
+			Description: m.spec.Name,
+			DpmsStatus:  true,
+			Focused:     m == s.focusedMon,
+			Height:      m.spec.Height,
+			ID:          m.id,
+			Name:        m.spec.Name,
+			RefreshRate: 60,
+			Reserved:    m.spec.Reserved[:],
+			Scale:       m.spec.Scale,
+			Width:       m.spec.Width,
+			X:           m.spec.X,
+			Y:           m.spec.Y,
+		}
+		hm.ActiveWorkspace.ID = m.activeWS.id
+		hm.ActiveWorkspace.Name = m.activeWS.name
+		out = append(out, hm)
+	}
+	return out
+}
+
+func (s *Server) workspaceByID(id int64) *workspace {
+	for _, ws := range s.workspaces {
+		if ws.id == id {
+			return ws
+		}
+	}
+	return nil
+}
+
+func (s *Server) workspaceByName(name string) *workspace {
+	for _, ws := range s.workspaces {
+		if ws.name == name {
+			return ws
+		}
+	}
+	return nil
+}
+
+func (s *Server) windowByAddr(addr string) *window {
+	n, err := strconv.ParseUint(strings.TrimPrefix(addr, "0x"), 16, 64)
+	if err != nil {
+		return nil
+	}
+	for _, w := range s.windows {
+		if w.addr == n {
+			return w
+		}
+	}
+	return nil
+}
+
+func parseOption(name, val string) hyprctl.Option {
+	opt := hyprctl.Option{
+		Option: name,
+		Set:    true,
+	}
+	switch strings.ToLower(val) {
+	case "yes", "true", "on":
+		opt.Int = 1
+		opt.Kind = "int"
+		return opt
+	case "no", "false", "off":
+		opt.Kind = "int"
+		return opt
+	}
+
+	if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+		opt.Int = i
+		opt.Kind = "int"
+	} else if f, err := strconv.ParseFloat(val, 64); err == nil {
+		opt.Float = f
+		opt.Kind = "float"
+	} else {
+		opt.Str = val
+		opt.Kind = "str"
+	}
+	return opt
+}
+
+func encodeJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+func formatAddr(addr uint64) string {
+	return fmt.Sprintf("0x%x", addr)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
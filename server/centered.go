@@ -0,0 +1,98 @@
+package server
+
+import (
+	"log"
+	"sort"
+
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+// centeredLayout uses the master layout's center orientation: the master
+// goes in the middle column and the stack alternates between the right and
+// left columns. WindowOrder is kept in tiling order, and like a stacked
+// workspace new windows become master.
+type centeredLayout struct {
+	s *server
+}
+
+func (l *centeredLayout) Mode() LayoutMode {
+	return LayoutCentered
+}
+
+func (l *centeredLayout) Enter(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	sort.Sort(WindowSort(allWindows))
+
+	var order []string
+	for _, w := range allWindows {
+		if w.Workspace.ID == wsState.ID && !w.Floating && !l.s.noStack[w.Address] {
+			order = append(order, w.Address)
+		}
+	}
+	wsState.WindowOrder = order
+
+	l.s.arrangeCentered(c, wsState)
+}
+
+// Exit switches the workspace back to the configured master layout
+// orientation. If the workspace is going back to the tiled layout, that
+// then applies the workspace's own orientation.
+func (l *centeredLayout) Exit(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	if len(wsState.WindowOrder) == 0 {
+		return
+	}
+
+	batch := c.Batch()
+	batch.Dispatchf("focuswindow address:%s", wsState.WindowOrder[0])
+	batch.Dispatchf("layoutmsg orientation%s", defaultOrientation(c))
+	if _, err := batch.Run(); err != nil {
+		log.Printf("exit centered err: %s", err)
+	}
+}
+
+func (l *centeredLayout) WindowOpened(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string) bool {
+	wsState.WindowOrder = append([]string{addr}, wsState.WindowOrder...)
+	l.s.arrangeCentered(c, wsState)
+	return true
+}
+
+func (l *centeredLayout) WindowClosed(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string, idx int) {
+}
+
+func (l *centeredLayout) Focus(c *hyprctl.Client, wsState *WorkspaceDesiredState, n int) {
+	cyclePrimary(c, n)
+}
+
+// arrangeCentered puts the workspace's windows in WindowOrder with the
+// master in the middle. moveWindowsToOrder works out the current order
+// from window positions, which only matches the tiling order while the
+// stack is on one side, so the workspace is left oriented while we
+// reorder.
+func (s *server) arrangeCentered(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	if len(wsState.WindowOrder) == 0 {
+		return
+	}
+
+	batch := c.Batch()
+	batch.Dispatchf("focuswindow address:%s", wsState.WindowOrder[0])
+	batch.Dispatch("layoutmsg orientationleft")
+	if _, err := batch.Run(); err != nil {
+		log.Printf("arrange centered err: %s", err)
+	}
+
+	s.moveWindowsToOrder(c, &hyprctl.Workspace{ID: wsState.ID, Name: wsState.Name}, wsState.WindowOrder)
+
+	// moveWindowsToOrder leaves the master focused
+	batch = c.Batch()
+	batch.Dispatch("layoutmsg orientationcenter")
+	if wsState.MFact != 0 {
+		batch.Dispatchf("layoutmsg mfact exact %.3f", wsState.MFact)
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("arrange centered err: %s", err)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/psanford/hypr-buddy/config"
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+func (s *server) handleReload(w http.ResponseWriter, r *http.Request) {
+	err := s.reloadConfig()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "reload config err: %s", err)
+		return
+	}
+	fmt.Fprintf(w, "ok")
+}
+
+// reloadConfig re-reads the config file. If the file is invalid the
+// current config is kept.
+func (s *server) reloadConfig() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	oldHidden := s.cfg.Stack.HiddenWorkspace
+	s.cfg = cfg
+
+	if oldHidden != cfg.Stack.HiddenWorkspace {
+		s.renameHiddenWorkspaces(oldHidden)
+	}
+
+	// rule indexes may have changed
+	s.seedRules()
+
+	return nil
+}
+
+// renameHiddenWorkspaces moves windows parked under the old hidden
+// workspace naming scheme to the current one.
+func (s *server) renameHiddenWorkspaces(oldFormat string) {
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	batch := c.Batch()
+	for _, w := range allWindows {
+		id, ok := parseHiddenWSNameFormat(oldFormat, w.Workspace.Name)
+		if !ok {
+			continue
+		}
+		batch.Dispatchf("movetoworkspacesilent %s,address:%s", s.hiddenWSName(id), w.Address)
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("rename hidden workspaces err: %s", err)
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/psanford/hypr-buddy/client"
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+// handleEvents streams client.State as server-sent events. The current
+// state is sent as soon as the client connects, and again every time it
+// changes.
+//
+// This handler is not serialized since it runs for as long as the client
+// stays connected. It only touches s.spaces through runOnLoop.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "streaming not supported")
+		return
+	}
+
+	ch := make(chan []byte, 1)
+
+	p, ok := s.runOnLoop(r.Context(), "/events subscribe", func() {
+		s.subscribe(ch)
+	})
+	if p != nil {
+		panic(p)
+	} else if !ok {
+		return
+	}
+	defer s.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	for {
+		select {
+		case b := <-ch:
+			_, err := fmt.Fprintf(w, "data: %s\n\n", b)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// subscribe registers ch for state updates and sends it the current
+// state. It must be called on the Serve goroutine.
+func (s *server) subscribe(ch chan []byte) {
+	s.subMu.Lock()
+	s.subs[ch] = struct{}{}
+	s.subMu.Unlock()
+
+	b, err := json.Marshal(s.currentState())
+	if err != nil {
+		panic(err)
+	}
+	ch <- b
+}
+
+func (s *server) unsubscribe(ch chan []byte) {
+	s.subMu.Lock()
+	delete(s.subs, ch)
+	s.subMu.Unlock()
+}
+
+// publishState sends the current state to every subscriber if it changed
+// since the last call. It is called after every event the Serve loop
+// handles, rather than from each place that modifies s.spaces.
+func (s *server) publishState() {
+	b, err := json.Marshal(s.currentState())
+	if err != nil {
+		log.Printf("marshal state err: %s", err)
+		return
+	}
+	if string(b) == string(s.lastPublished) {
+		return
+	}
+	s.lastPublished = b
+
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	for ch := range s.subs {
+		// a slow subscriber only needs the newest state, so replace
+		// anything it hasn't read yet
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- b
+	}
+}
+
+func (s *server) currentState() client.State {
+	st := client.State{
+		ActiveWindow: s.activeWindow,
+		Workspaces:   make([]client.WorkspaceState, 0, len(s.spaces)),
+	}
+
+	for _, wsState := range s.sortedSpaces() {
+		ws := client.WorkspaceState{
+			ID:      wsState.ID,
+			Name:    wsState.Name,
+			Layout:  wsState.Layout.String(),
+			Windows: wsState.WindowOrder,
+		}
+		if ws.Windows == nil {
+			ws.Windows = []string{}
+		}
+		if wsState.Layout == LayoutSingleWindow && len(ws.Windows) > 0 {
+			ws.Hidden = len(ws.Windows) - 1
+		}
+
+		if wsState.ID == s.focusedWS {
+			focused := ws
+			st.Workspace = &focused
+		}
+		st.Workspaces = append(st.Workspaces, ws)
+	}
+
+	if st.Workspace == nil && s.focusedWS != 0 {
+		st.Workspace = &client.WorkspaceState{
+			ID:      s.focusedWS,
+			Layout:  LayoutPrimaryWithStack.String(),
+			Windows: []string{},
+		}
+	}
+
+	return st
+}
+
+// updateFocusedWS refreshes the focused workspace from Hyprland. Used at
+// startup and for focusedmon events, which only include the workspace
+// name.
+func (s *server) updateFocusedWS() {
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	wsInfo, err := c.ActiveWorkspace()
+	if err != nil {
+		log.Printf("get active workspace err: %s", err)
+		return
+	}
+	s.focusedWS = wsInfo.ID
+
+	if !isSpecialWS(wsInfo.Name) {
+		s.getWSState(wsInfo.ID, wsInfo.Name)
+	}
+}
+
+func (s *server) handleWorkspaceFocus(evt hyprctl.WorkspaceV2Event) {
+	if isSpecialWS(evt.Name) {
+		return
+	}
+	s.focusedWS = evt.ID
+	s.getWSState(evt.ID, evt.Name)
+}
+
+// runOnLoop runs f on the Serve goroutine and waits for it to return. It
+// returns the value f panicked with, if any, and false if ctx was done
+// before f could run.
+func (s *server) runOnLoop(ctx context.Context, name string, f func()) (interface{}, bool) {
+	cmd := userCmd{
+		name: name,
+		run:  f,
+		done: make(chan interface{}, 1),
+	}
+
+	select {
+	case s.userEvt <- cmd:
+	case <-ctx.Done():
+		return nil, false
+	}
+
+	return <-cmd.done, true
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+// gridLayout floats every window on the workspace and places them in an
+// evenly divided grid. WindowOrder holds the windows in the grid, left to
+// right and then top to bottom.
+type gridLayout struct {
+	s *server
+}
+
+func (l *gridLayout) Mode() LayoutMode {
+	return LayoutGrid
+}
+
+func (l *gridLayout) Enter(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	sort.Sort(WindowSort(allWindows))
+
+	// windows that are already floating are left alone
+	var order []string
+	for _, w := range allWindows {
+		if w.Workspace.ID == wsState.ID && !w.Floating && !l.s.noStack[w.Address] {
+			order = append(order, w.Address)
+		}
+	}
+	wsState.WindowOrder = order
+
+	l.s.arrangeGrid(c, wsState)
+}
+
+// Exit tiles the grid's windows again, in grid order.
+func (l *gridLayout) Exit(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	if len(wsState.WindowOrder) == 0 {
+		return
+	}
+
+	// new tiled windows become master, so tile in reverse order
+	batch := c.Batch()
+	for i := len(wsState.WindowOrder) - 1; i >= 0; i-- {
+		batch.Dispatchf("settiled address:%s", wsState.WindowOrder[i])
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("tile windows err: %s", err)
+	}
+
+	l.s.moveWindowsToOrder(c, &hyprctl.Workspace{ID: wsState.ID, Name: wsState.Name}, wsState.WindowOrder)
+}
+
+func (l *gridLayout) WindowOpened(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string) bool {
+	wsState.WindowOrder = append(wsState.WindowOrder, addr)
+	l.s.arrangeGrid(c, wsState)
+	return true
+}
+
+func (l *gridLayout) WindowClosed(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string, idx int) {
+	l.s.arrangeGrid(c, wsState)
+}
+
+// Focus moves focus n windows along the grid from the focused window.
+func (l *gridLayout) Focus(c *hyprctl.Client, wsState *WorkspaceDesiredState, n int) {
+	order := wsState.WindowOrder
+	if len(order) == 0 {
+		return
+	}
+
+	idx := -1
+	for i, addr := range order {
+		if addr == l.s.activeWindow {
+			idx = i
+		}
+	}
+
+	var next int
+	if idx < 0 {
+		next = 0
+	} else {
+		next = ((idx+n)%len(order) + len(order)) % len(order)
+	}
+
+	c.DispatchRaw(fmt.Sprintf("focuswindow address:%s", order[next]))
+}
+
+// arrangeGrid floats the windows in wsState.WindowOrder and places them in
+// the grid. It is called whenever a window joins or leaves the grid.
+func (s *server) arrangeGrid(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	n := len(wsState.WindowOrder)
+	if n == 0 {
+		return
+	}
+
+	area, ok := workspaceArea(c, wsState.ID)
+	if !ok {
+		log.Printf("arrange grid: no monitor for workspace %d", wsState.ID)
+		return
+	}
+
+	gapsIn := optionInt(c, "general:gaps_in")
+	gapsOut := optionInt(c, "general:gaps_out")
+	// gaps_in is applied to both windows on either side of a gap
+	between := 2 * gapsIn
+
+	area.x += gapsOut
+	area.y += gapsOut
+	area.w -= 2 * gapsOut
+	area.h -= 2 * gapsOut
+
+	cols := int(math.Ceil(math.Sqrt(float64(n))))
+	rows := (n + cols - 1) / cols
+
+	cellH := (area.h - int64(rows-1)*between) / int64(rows)
+
+	batch := c.Batch()
+	for i, addr := range wsState.WindowOrder {
+		row := i / cols
+		col := i % cols
+
+		// the last row may be short; its windows share the full width
+		inRow := cols
+		if row == rows-1 {
+			inRow = n - cols*(rows-1)
+		}
+		cellW := (area.w - int64(inRow-1)*between) / int64(inRow)
+
+		x := area.x + int64(col)*(cellW+between)
+		y := area.y + int64(row)*(cellH+between)
+
+		batch.Dispatchf("setfloating address:%s", addr)
+		batch.Dispatchf("resizewindowpixel exact %d %d,address:%s", cellW, cellH, addr)
+		batch.Dispatchf("movewindowpixel exact %d %d,address:%s", x, y, addr)
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("arrange grid err: %s", err)
+	}
+}
+
+type rect struct {
+	x, y, w, h int64
+}
+
+// workspaceArea returns the part of the workspace's monitor that windows
+// can use, in layout coordinates.
+func workspaceArea(c *hyprctl.Client, wsID int64) (rect, bool) {
+	workspaces, err := c.Workspaces()
+	if err != nil {
+		panic(err)
+	}
+
+	monitorID := int64(-1)
+	for _, ws := range workspaces {
+		if ws.ID == wsID {
+			monitorID = ws.MonitorID
+		}
+	}
+
+	monitors, err := c.Monitors()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, m := range monitors {
+		if m.ID != monitorID {
+			continue
+		}
+
+		scale := m.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		w := int64(float64(m.Width) / scale)
+		h := int64(float64(m.Height) / scale)
+		if m.Transform%2 == 1 {
+			// rotated 90 or 270 degrees
+			w, h = h, w
+		}
+
+		// reserved is left, top, right, bottom
+		var reserved [4]int64
+		copy(reserved[:], m.Reserved)
+
+		return rect{
+			x: m.X + reserved[0],
+			y: m.Y + reserved[1],
+			w: w - reserved[0] - reserved[2],
+			h: h - reserved[1] - reserved[3],
+		}, true
+	}
+
+	return rect{}, false
+}
+
+// optionInt returns an integer option. Newer versions of Hyprland report
+// gaps as a custom "top right bottom left" value, in which case the first
+// one is used.
+func optionInt(c *hyprctl.Client, name string) int64 {
+	opt, err := c.GetOption(name)
+	if err != nil {
+		log.Printf("get option %s err: %s", name, err)
+		return 0
+	}
+
+	fields := strings.Fields(opt.Value())
+	if len(fields) == 0 {
+		return 0
+	}
+	n, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
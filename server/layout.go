@@ -0,0 +1,186 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/psanford/hypr-buddy/hyprctl"
+	"github.com/psanford/logmiddleware"
+)
+
+// Layout is a way of arranging the windows on a workspace. Every
+// LayoutMode has one registered in server.layouts.
+//
+// Layouts are switched by calling Exit on the old layout and then Enter on
+// the new one. Exit must leave every window visible and tiled by Hyprland's
+// master layout, in WindowOrder if the layout kept one.
+type Layout interface {
+	Mode() LayoutMode
+
+	Enter(c *hyprctl.Client, wsState *WorkspaceDesiredState)
+	Exit(c *hyprctl.Client, wsState *WorkspaceDesiredState)
+
+	// WindowOpened is called when a tiled window arrives on the
+	// workspace, either newly opened or moved from elsewhere. It returns
+	// false if the layout doesn't track windows.
+	WindowOpened(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string) bool
+	// WindowClosed is called after addr, which was at index idx, has been
+	// removed from WindowOrder because it closed or left the workspace.
+	WindowClosed(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string, idx int)
+
+	// Focus moves focus n windows forward, or backward if n is negative.
+	Focus(c *hyprctl.Client, wsState *WorkspaceDesiredState, n int)
+}
+
+// layout returns the registered layout for mode, falling back to the
+// master layout for modes we don't know about, say from an old state file.
+func (s *server) layout(mode LayoutMode) Layout {
+	for _, l := range s.layouts {
+		if l.Mode() == mode {
+			return l
+		}
+	}
+	return s.layouts[0]
+}
+
+func (s *server) layoutByName(name string) (Layout, bool) {
+	for _, l := range s.layouts {
+		if l.Mode().String() == name {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+func (s *server) layoutNames() []string {
+	names := make([]string, 0, len(s.layouts))
+	for _, l := range s.layouts {
+		names = append(names, l.Mode().String())
+	}
+	return names
+}
+
+func (s *server) setLayout(c *hyprctl.Client, wsState *WorkspaceDesiredState, mode LayoutMode) {
+	if wsState.Layout == mode {
+		return
+	}
+
+	log.Printf("workspace %d layout %s -> %s", wsState.ID, wsState.Layout, mode)
+
+	s.layout(wsState.Layout).Exit(c, wsState)
+	wsState.Layout = mode
+	s.layout(mode).Enter(c, wsState)
+
+	s.saveState()
+}
+
+func (s *server) activeWSState(c *hyprctl.Client) *WorkspaceDesiredState {
+	wsInfo, err := c.ActiveWorkspace()
+	if err != nil {
+		panic(err)
+	}
+
+	return s.getWSState(wsInfo.ID, wsInfo.Name)
+}
+
+func (s *server) handleSetLayout(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+	name := r.FormValue("name")
+
+	l, ok := s.layoutByName(name)
+	if !ok {
+		lgr.Error("unknown layout", "name", name)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request unknown layout %q, want one of %s", name, strings.Join(s.layoutNames(), ", "))
+		return
+	}
+
+	s.pushSnapshot()
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	s.setLayout(c, s.activeWSState(c), l.Mode())
+}
+
+func (s *server) handleNextLayout(w http.ResponseWriter, r *http.Request) {
+	s.pushSnapshot()
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	wsState := s.activeWSState(c)
+
+	next := s.layouts[0]
+	for i, l := range s.layouts {
+		if l.Mode() == wsState.Layout {
+			next = s.layouts[(i+1)%len(s.layouts)]
+		}
+	}
+
+	s.setLayout(c, wsState, next.Mode())
+	fmt.Fprintf(w, "%s", next.Mode())
+}
+
+// toggleLayout returns a handler that switches the active workspace to
+// mode, or back to the master layout if it is already using mode.
+func (s *server) toggleLayout(mode LayoutMode) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.pushSnapshot()
+
+		c, err := hyprctl.New()
+		if err != nil {
+			panic(err)
+		}
+
+		wsState := s.activeWSState(c)
+		if wsState.Layout == mode {
+			s.setLayout(c, wsState, LayoutPrimaryWithStack)
+		} else {
+			s.setLayout(c, wsState, mode)
+		}
+	}
+}
+
+// masterLayout leaves everything to Hyprland's master layout.
+type masterLayout struct {
+	s *server
+}
+
+func (l *masterLayout) Mode() LayoutMode {
+	return LayoutPrimaryWithStack
+}
+
+func (l *masterLayout) Enter(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	l.s.applyMaster(c, wsState)
+}
+
+func (l *masterLayout) Exit(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	l.s.resetMaster(c, wsState)
+}
+
+func (l *masterLayout) WindowOpened(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string) bool {
+	return false
+}
+
+func (l *masterLayout) WindowClosed(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string, idx int) {
+}
+
+func (l *masterLayout) Focus(c *hyprctl.Client, wsState *WorkspaceDesiredState, n int) {
+	cyclePrimary(c, n)
+}
+
+func cyclePrimary(c *hyprctl.Client, n int) {
+	cmd := "layoutmsg cyclenext"
+	if n < 0 {
+		cmd = "layoutmsg cycleprev"
+	}
+	log.Printf("Multi layout, cmd: %s", cmd)
+	c.DispatchRaw(cmd)
+}
@@ -0,0 +1,376 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/psanford/hypr-buddy/hyprctl"
+	"github.com/psanford/logmiddleware"
+)
+
+// mfact limits, the same as Hyprland's
+const (
+	minMFact = 0.05
+	maxMFact = 0.95
+)
+
+// handleMasterGrow changes the master width of the active workspace by
+// step, a fraction of the monitor width.
+func (s *server) handleMasterGrow(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+	stepStr := r.FormValue("step")
+	step, err := strconv.ParseFloat(stepStr, 64)
+	if err != nil {
+		lgr.Error("invalid step value", "step", stepStr)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request invalid step parameter")
+		return
+	}
+
+	s.pushSnapshot()
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	wsState := s.activeWSState(c)
+	s.setMFact(c, wsState, s.mfact(c, wsState)+step)
+}
+
+// handleMFact sets the master width of the active workspace to value, a
+// fraction of the monitor width.
+func (s *server) handleMFact(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+	valueStr := r.FormValue("value")
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		lgr.Error("invalid mfact value", "value", valueStr)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request invalid value parameter")
+		return
+	}
+
+	s.pushSnapshot()
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	s.setMFact(c, s.activeWSState(c), value)
+}
+
+// mfact returns the workspace's master width: the last one we set with
+// layoutmsg mfact exact, falling back to Hyprland's master:mfact. The
+// window sizes aren't used since gaps and borders throw them off.
+func (s *server) mfact(c *hyprctl.Client, wsState *WorkspaceDesiredState) float64 {
+	if wsState.MFact != 0 {
+		return wsState.MFact
+	}
+
+	opt, err := c.GetOption("master:mfact")
+	if err == nil && opt.Float > 0 {
+		return opt.Float
+	}
+	// Hyprland's default
+	return 0.55
+}
+
+// setMFact clamps v and makes it the workspace's master width. On a
+// workspace without a master it is only recorded, for when it has one
+// again.
+func (s *server) setMFact(c *hyprctl.Client, wsState *WorkspaceDesiredState, v float64) {
+	v = min(max(v, minMFact), maxMFact)
+	// round so repeated steps don't pile up float error
+	v = math.Round(v*1000) / 1000
+
+	wsState.MFact = v
+	s.saveState()
+
+	if wsState.Layout != LayoutPrimaryWithStack && wsState.Layout != LayoutCentered {
+		return
+	}
+	if len(tiledWindows(c, wsState.ID)) == 0 {
+		return
+	}
+
+	c.DispatchRaw(fmt.Sprintf("layoutmsg mfact exact %.3f", v))
+}
+
+// orientations are the master layout orientations -orientation accepts.
+var orientations = []string{"left", "right", "top", "bottom", "center"}
+
+// defaultOrientation is Hyprland's master:orientation. Center is treated
+// as left, since the centered layout manages that itself.
+func defaultOrientation(c *hyprctl.Client) string {
+	opt, err := c.GetOption("master:orientation")
+	if err == nil && opt.Str != "" && opt.Str != "center" {
+		return opt.Str
+	}
+	return "left"
+}
+
+// tiledWindows returns the workspace's tiled windows in WindowSort order.
+func tiledWindows(c *hyprctl.Client, wsID int64) []hyprctl.Window {
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	sort.Sort(WindowSort(allWindows))
+
+	var tiled []hyprctl.Window
+	for _, w := range allWindows {
+		if w.Workspace.ID == wsID && !w.Floating {
+			tiled = append(tiled, w)
+		}
+	}
+	return tiled
+}
+
+// clampMasters lowers the master count of each workspace to the number of
+// windows it has left to tile, as Hyprland does when masters close or move
+// away. A workspace that isn't tiled is counted by its window order.
+func (s *server) clampMasters(c *hyprctl.Client) {
+	var need bool
+	for _, wsState := range s.spaces {
+		need = need || wsState.Masters > 1
+	}
+	if !need {
+		return
+	}
+
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	tiled := make(map[int64]int)
+	for _, w := range allWindows {
+		if !w.Floating {
+			tiled[w.Workspace.ID]++
+		}
+	}
+
+	var changed bool
+	for _, wsState := range s.sortedSpaces() {
+		n := tiled[wsState.ID]
+		if wsState.Layout != LayoutPrimaryWithStack {
+			n = len(wsState.WindowOrder)
+		}
+		if n = max(n, 1); wsState.Masters > n {
+			log.Printf("workspace %d masters %d -> %d", wsState.ID, wsState.Masters, n)
+			wsState.Masters = n
+			changed = true
+		}
+	}
+	if changed {
+		s.saveState()
+	}
+}
+
+// applyMaster sets the workspace's master count, orientation and mfact in
+// Hyprland. Hyprland forgets which windows are masters once they leave
+// the workspace, as they do while stacked, so this is done every time the
+// workspace goes back to the tiled layout.
+func (s *server) applyMaster(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	tiled := tiledWindows(c, wsState.ID)
+	if len(tiled) == 0 {
+		return
+	}
+
+	orientation := wsState.Orientation
+	if orientation == "" {
+		orientation = defaultOrientation(c)
+	}
+
+	// the other layouts leave the master on the left. removemaster
+	// demotes the active window if it is a master, so start from the
+	// end of the stack, then add masters back from the front.
+	batch := c.Batch()
+	batch.Dispatchf("focuswindow address:%s", tiled[len(tiled)-1].Address)
+	for range tiled[1:] {
+		batch.Dispatch("layoutmsg removemaster")
+	}
+	batch.Dispatchf("focuswindow address:%s", tiled[0].Address)
+	for i := 1; i < wsState.Masters; i++ {
+		batch.Dispatch("layoutmsg addmaster")
+	}
+	batch.Dispatchf("layoutmsg orientation%s", orientation)
+	if wsState.MFact != 0 {
+		batch.Dispatchf("layoutmsg mfact exact %.3f", wsState.MFact)
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("apply master err: %s", err)
+	}
+}
+
+// resetMaster puts the workspace back to one master in the default
+// orientation when it leaves the tiled layout, since the other layouts
+// work out window order from positions.
+func (s *server) resetMaster(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	if wsState.Masters <= 1 && wsState.Orientation == "" {
+		return
+	}
+
+	tiled := tiledWindows(c, wsState.ID)
+	if len(tiled) == 0 {
+		return
+	}
+
+	batch := c.Batch()
+	batch.Dispatchf("focuswindow address:%s", tiled[0].Address)
+	batch.Dispatchf("layoutmsg orientation%s", defaultOrientation(c))
+	if _, err := batch.Run(); err != nil {
+		log.Printf("reset orientation err: %s", err)
+	}
+
+	// positions have changed with the orientation
+	tiled = tiledWindows(c, wsState.ID)
+
+	batch = c.Batch()
+	batch.Dispatchf("focuswindow address:%s", tiled[len(tiled)-1].Address)
+	for range tiled[1:] {
+		batch.Dispatch("layoutmsg removemaster")
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("reset masters err: %s", err)
+	}
+}
+
+// handleMasterCount adds n masters to the active workspace, or removes
+// them if n is negative. On a workspace that isn't tiled the count is
+// only recorded, for when it is tiled again.
+func (s *server) handleMasterCount(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+	nStr := r.FormValue("n")
+	n, err := strconv.Atoi(nStr)
+	if err != nil {
+		lgr.Error("invalid non-numeric n value", "n", nStr)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request invalid non-numeric n parameter")
+		return
+	}
+
+	s.pushSnapshot()
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	wsState := s.activeWSState(c)
+	masters := max(wsState.Masters, 1) + n
+
+	if wsState.Layout != LayoutPrimaryWithStack {
+		wsState.Masters = max(masters, 1)
+		s.saveState()
+		return
+	}
+
+	// like Hyprland, keep at least one master and one window per master
+	tiled := tiledWindows(c, wsState.ID)
+	masters = min(max(masters, 1), max(len(tiled), 1))
+
+	cmd := "layoutmsg addmaster"
+	steps := masters - max(wsState.Masters, 1)
+	if steps < 0 {
+		cmd = "layoutmsg removemaster"
+		steps = -steps
+	}
+	batch := c.Batch()
+	for i := 0; i < steps; i++ {
+		batch.Dispatch(cmd)
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("master count err: %s", err)
+	}
+
+	wsState.Masters = masters
+	s.saveState()
+}
+
+// handleOrientation sets the active workspace's master orientation. On a
+// workspace that isn't tiled it is only recorded, for when it is tiled
+// again.
+func (s *server) handleOrientation(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+	name := r.FormValue("name")
+
+	valid := false
+	for _, o := range orientations {
+		valid = valid || o == name
+	}
+	if !valid {
+		lgr.Error("unknown orientation", "name", name)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request unknown orientation %q, must be one of %s", name, strings.Join(orientations, ", "))
+		return
+	}
+
+	s.pushSnapshot()
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	wsState := s.activeWSState(c)
+	wsState.Orientation = name
+
+	if wsState.Layout == LayoutPrimaryWithStack {
+		c.DispatchRaw(fmt.Sprintf("layoutmsg orientation%s", name))
+	}
+
+	s.saveState()
+}
+
+// handleSwapMaster swaps the active window with the master, or with the
+// first stack window if it is the master.
+func (s *server) handleSwapMaster(w http.ResponseWriter, r *http.Request) {
+	s.pushSnapshot()
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	wsState := s.activeWSState(c)
+
+	switch wsState.Layout {
+	case LayoutPrimaryWithStack:
+		c.DispatchRaw("layoutmsg swapwithmaster")
+	case LayoutCentered:
+		win, err := c.ActiveWindow()
+		if err != nil {
+			panic(err)
+		}
+
+		idx := -1
+		for i, addr := range wsState.WindowOrder {
+			if addr == win.Address {
+				idx = i
+			}
+		}
+		other := 0
+		if idx == 0 {
+			other = 1
+		}
+		if idx < 0 || other >= len(wsState.WindowOrder) {
+			return
+		}
+
+		order := wsState.WindowOrder
+		order[idx], order[other] = order[other], order[idx]
+		c.DispatchRaw("layoutmsg swapwithmaster")
+		s.saveState()
+	default:
+		log.Printf("no master to swap with in %s layout", wsState.Layout)
+	}
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/psanford/hypr-buddy/hyprctl"
+	"github.com/psanford/logmiddleware"
+)
+
+// mruSession is an in-progress -focus-mru switch. While it is active the
+// MRU list is frozen so repeated presses walk further down the same
+// history instead of bouncing between the two most recent windows.
+type mruSession struct {
+	order []string
+	idx   int
+	timer *time.Timer
+}
+
+// mruSettleDelay is how long after a daemon command the MRU list ignores
+// focus changes. Commands like -toggle-stack focus windows as they
+// rearrange them, and those focuswindow dispatches come back as events
+// after the command has returned; only the window focus ends up on
+// should count as used.
+const mruSettleDelay = 250 * time.Millisecond
+
+// noteActiveWindow moves addr to the front of the MRU list, unless the
+// list is frozen by a -focus-mru switch or a daemon command that is
+// still settling.
+func (s *server) noteActiveWindow(addr string) {
+	s.activeWindow = addr
+	if s.mruSession != nil || s.mruSettle != nil {
+		return
+	}
+
+	s.pushMRU(addr)
+}
+
+func (s *server) pushMRU(addr string) {
+	if addr == "" {
+		return
+	}
+	s.mru = append([]string{addr}, removeAddr(s.mru, addr)...)
+}
+
+// holdMRU freezes the MRU list until mruSettleDelay after the last
+// daemon command.
+func (s *server) holdMRU() {
+	if s.mruSettle == nil {
+		s.mruSettle = time.NewTimer(mruSettleDelay)
+		return
+	}
+	if !s.mruSettle.Stop() {
+		select {
+		case <-s.mruSettle.C:
+		default:
+		}
+	}
+	s.mruSettle.Reset(mruSettleDelay)
+}
+
+// mruSettled returns a channel that fires when the daemon's focus changes
+// have settled, or nil if the MRU list isn't held.
+func (s *server) mruSettled() <-chan time.Time {
+	if s.mruSettle == nil {
+		return nil
+	}
+	return s.mruSettle.C
+}
+
+// settleMRU unfreezes the MRU list, counting the window the daemon's
+// commands left focused as the most recent.
+func (s *server) settleMRU() {
+	s.mruSettle = nil
+	if s.mruSession == nil {
+		s.pushMRU(s.activeWindow)
+	}
+}
+
+func (s *server) forgetWindow(addr string) {
+	s.mru = removeAddr(s.mru, addr)
+}
+
+func removeAddr(addrs []string, addr string) []string {
+	out := make([]string, 0, len(addrs))
+	for _, other := range addrs {
+		if other != addr {
+			out = append(out, other)
+		}
+	}
+	return out
+}
+
+// mruCommit returns a channel that fires when the current session times
+// out, or nil if there is no session.
+func (s *server) mruCommit() <-chan time.Time {
+	if s.mruSession == nil {
+		return nil
+	}
+	return s.mruSession.timer.C
+}
+
+// commitMRU ends the current session, making the window it landed on the
+// most recent.
+func (s *server) commitMRU() {
+	s.mruSession.timer.Stop()
+	s.mruSession = nil
+
+	s.pushMRU(s.activeWindow)
+}
+
+// seedMRU fills the MRU list from Hyprland's own focus history, so it is
+// useful straight after the daemon starts.
+func (s *server) seedMRU() {
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	allWindows, err := c.Windows()
+	if err != nil {
+		log.Printf("seed mru err: %s", err)
+		return
+	}
+
+	var seen []hyprctl.Window
+	for _, w := range allWindows {
+		// -1 means never focused
+		if w.FocusHistoryID >= 0 {
+			seen = append(seen, w)
+		}
+	}
+	sort.Slice(seen, func(i, j int) bool {
+		return seen[i].FocusHistoryID < seen[j].FocusHistoryID
+	})
+
+	s.mru = s.mru[:0]
+	for _, w := range seen {
+		s.mru = append(s.mru, w.Address)
+	}
+}
+
+func (s *server) handleFocusMRU(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+	n := 1
+	nStr := r.FormValue("n")
+	if nStr != "" {
+		var err error
+		n, err = strconv.Atoi(nStr)
+		if err != nil {
+			lgr.Error("invalid non-numeric n value", "n", nStr)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Bad request invalid non-numeric n parameter")
+			return
+		}
+	}
+
+	s.pushSnapshot()
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	sess := s.mruSession
+	if sess == nil {
+		order := s.mruCandidates(c)
+		if len(order) < 2 {
+			log.Printf("mru < 2, nothing to switch to")
+			return
+		}
+		sess = &mruSession{
+			order: order,
+			timer: time.NewTimer(s.cfg.MRU.CommitTimeout),
+		}
+		s.mruSession = sess
+	} else {
+		// if the timer fired but the loop hasn't read it yet, drain it
+		// so the reset session doesn't commit straight away
+		if !sess.timer.Stop() {
+			select {
+			case <-sess.timer.C:
+			default:
+			}
+		}
+		sess.timer.Reset(s.cfg.MRU.CommitTimeout)
+	}
+
+	sess.idx = ((sess.idx+n)%len(sess.order) + len(sess.order)) % len(sess.order)
+
+	s.focusWindow(c, sess.order[sess.idx])
+}
+
+// mruCandidates is the MRU list limited to windows that still exist and
+// that we know how to focus. Windows in scratchpads and other special
+// workspaces are skipped, but windows hidden in a stack are not.
+func (s *server) mruCandidates(c *hyprctl.Client) []string {
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	windowsByID := make(map[string]hyprctl.Window)
+	for _, w := range allWindows {
+		windowsByID[w.Address] = w
+	}
+
+	var order []string
+	for _, addr := range s.mru {
+		w, ok := windowsByID[addr]
+		if !ok {
+			continue
+		}
+		if _, hidden := s.parseHiddenWSName(w.Workspace.Name); isSpecialWS(w.Workspace.Name) && !hidden {
+			continue
+		}
+		order = append(order, addr)
+	}
+	return order
+}
+
+// focusWindow focuses addr. If it is hidden in a stack, the stack is
+// rotated to make it the master first.
+func (s *server) focusWindow(c *hyprctl.Client, addr string) {
+	wsState, idx := s.findInOrder(addr)
+	if wsState != nil && wsState.Layout == LayoutSingleWindow && idx > 0 {
+		oldMaster := wsState.WindowOrder[0]
+
+		// rotate rather than swap so -focus-next still visits the
+		// windows in the same order
+		order := make([]string, 0, len(wsState.WindowOrder))
+		order = append(order, wsState.WindowOrder[idx:]...)
+		order = append(order, wsState.WindowOrder[:idx]...)
+		wsState.WindowOrder = order
+
+		batch := c.Batch()
+		batch.Dispatchf("movetoworkspacesilent %s,address:%s", wsState.selector(), addr)
+		batch.Dispatchf("movetoworkspacesilent %s,address:%s", s.hiddenWSName(wsState.ID), oldMaster)
+		batch.Dispatchf("focuswindow address:%s", addr)
+		if _, err := batch.Run(); err != nil {
+			log.Printf("focus window err: %s", err)
+		}
+
+		s.saveState()
+		return
+	}
+
+	err := c.DispatchRaw(fmt.Sprintf("focuswindow address:%s", addr))
+	if err != nil {
+		log.Printf("focus window err: %s", err)
+	}
+}
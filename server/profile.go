@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/psanford/hypr-buddy/client"
+	"github.com/psanford/hypr-buddy/config"
+	"github.com/psanford/hypr-buddy/hyprctl"
+	"github.com/psanford/logmiddleware"
+)
+
+func (s *server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+	name := r.FormValue("name")
+
+	if name == config.RestoreProfile {
+		s.restoreProfile()
+		return
+	}
+
+	opts, ok := s.cfg.Profiles[name]
+	if !ok {
+		lgr.Error("unknown profile", "name", name)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request unknown profile %q", name)
+		return
+	}
+
+	if err := s.applyProfile(name, opts); err != nil {
+		lgr.Error("apply profile err", "name", name, "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request %s", err)
+		return
+	}
+}
+
+func (s *server) handleListProfiles(w http.ResponseWriter, r *http.Request) {
+	list := client.ProfileList{
+		Active:   s.activeProfile,
+		Profiles: make([]string, 0, len(s.cfg.Profiles)),
+	}
+	for name := range s.cfg.Profiles {
+		list.Profiles = append(list.Profiles, name)
+	}
+	sort.Strings(list.Profiles)
+
+	json.NewEncoder(w).Encode(list)
+}
+
+// applyProfile sets every option in opts. Before an option is changed for
+// the first time its current value is saved, so restoreProfile can put
+// back exactly what was there before, even after switching between
+// several profiles. Options set by a previous profile but not by this one
+// are put back to their saved value. If any option can't be read nothing
+// is changed.
+func (s *server) applyProfile(name string, opts map[string]string) error {
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	names := sortedKeys(opts)
+
+	// read every original value first, so an unknown option doesn't
+	// leave the snapshot half filled
+	origs := make(map[string]string)
+	for _, opt := range names {
+		if _, saved := s.profileSnapshot[opt]; saved {
+			continue
+		}
+		orig, err := c.GetOption(opt)
+		if err != nil {
+			return fmt.Errorf("get option %s: %w", opt, err)
+		}
+		origs[opt] = orig.Value()
+	}
+
+	if s.profileSnapshot == nil {
+		s.profileSnapshot = make(map[string]string)
+	}
+	for opt, orig := range origs {
+		s.profileSnapshot[opt] = orig
+	}
+
+	batch := c.Batch()
+	for _, opt := range sortedKeys(s.profileSnapshot) {
+		if _, ok := opts[opt]; !ok {
+			batch.SetOption(opt, s.profileSnapshot[opt])
+		}
+	}
+	for _, opt := range names {
+		batch.SetOption(opt, opts[opt])
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("apply profile %s err: %s", name, err)
+	}
+
+	s.activeProfile = name
+	s.saveState()
+	return nil
+}
+
+func (s *server) restoreProfile() {
+	if len(s.profileSnapshot) > 0 {
+		c, err := hyprctl.New()
+		if err != nil {
+			panic(err)
+		}
+
+		batch := c.Batch()
+		for _, opt := range sortedKeys(s.profileSnapshot) {
+			batch.SetOption(opt, s.profileSnapshot[opt])
+		}
+		if _, err := batch.Run(); err != nil {
+			log.Printf("restore profile err: %s", err)
+		}
+	}
+
+	s.activeProfile = ""
+	s.profileSnapshot = nil
+	s.saveState()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/psanford/hypr-buddy/config"
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+// ruleWindow is what rules match a window on, other than its title.
+type ruleWindow struct {
+	class        string
+	initialClass string
+	xwayland     bool
+	pid          int64
+}
+
+func newRuleWindow(win hyprctl.Window) ruleWindow {
+	return ruleWindow{
+		class:        win.Class,
+		initialClass: win.InitialClass,
+		xwayland:     win.Xwayland,
+		pid:          win.Pid,
+	}
+}
+
+func (rw ruleWindow) match(rc config.RuleConfig, title string) bool {
+	return rc.Match(rw.class, rw.initialClass, title, rw.xwayland, rw.pid)
+}
+
+// seedRules marks the rules that match windows which were already open as
+// fired, so restarting the daemon or reloading the config doesn't move
+// everything around again. no_stack and scratchpad rules still take
+// effect for them, and are rebuilt from the current rules so removing
+// one from the config undoes it.
+func (s *server) seedRules() {
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	allWindows, err := c.Windows()
+	if err != nil {
+		log.Printf("seed rules err: %s", err)
+		return
+	}
+
+	oldNoStack := s.noStack
+
+	s.rulesFired = make(map[string]map[int]bool)
+	s.noStack = make(map[string]bool)
+	s.ruleScratch = make(map[string]string)
+	s.ruleWindows = make(map[string]ruleWindow)
+	for _, win := range allWindows {
+		rw := newRuleWindow(win)
+		s.ruleWindows[win.Address] = rw
+
+		fired := make(map[int]bool)
+		for i, rc := range s.cfg.Rules {
+			if !rw.match(rc, win.Title) {
+				continue
+			}
+			fired[i] = true
+			if rc.NoStack {
+				s.noStack[win.Address] = true
+			}
+			if rc.Scratchpad != "" {
+				s.ruleScratch[win.Address] = rc.Scratchpad
+			}
+		}
+		s.rulesFired[win.Address] = fired
+
+		if s.noStack[win.Address] && !oldNoStack[win.Address] {
+			s.unstack(c, win)
+		}
+	}
+}
+
+// applyRules runs the rules that match win and haven't acted on it yet.
+// It returns true if a rule moved or floated the window, in which case
+// the events that causes take care of any stack.
+func (s *server) applyRules(c *hyprctl.Client, win hyprctl.Window) bool {
+	rw := newRuleWindow(win)
+	s.ruleWindows[win.Address] = rw
+
+	fired := s.rulesFired[win.Address]
+	if fired == nil {
+		fired = make(map[int]bool)
+		s.rulesFired[win.Address] = fired
+	}
+
+	var handled bool
+	floating, pinned := win.Floating, win.Pinned
+
+	batch := c.Batch()
+	for i, rc := range s.cfg.Rules {
+		if fired[i] || !rw.match(rc, win.Title) {
+			continue
+		}
+		fired[i] = true
+		log.Printf("rule %d matched %s (%s)", i, win.Address, win.Class)
+
+		if rc.NoStack && !s.noStack[win.Address] {
+			s.noStack[win.Address] = true
+			s.unstack(c, win)
+		}
+
+		if (rc.Float || rc.Pin) && !floating {
+			batch.Dispatchf("setfloating address:%s", win.Address)
+			floating = true
+			handled = true
+		}
+
+		// pin is a toggle
+		if rc.Pin && !pinned {
+			batch.Dispatchf("pin address:%s", win.Address)
+			pinned = true
+		}
+
+		if rc.Workspace != 0 && rc.Workspace != win.Workspace.ID {
+			batch.Dispatchf("movetoworkspacesilent %d,address:%s", rc.Workspace, win.Address)
+			handled = true
+		}
+
+		if rc.Scratchpad != "" {
+			s.ruleScratch[win.Address] = rc.Scratchpad
+			if win.Workspace.Name != scratchWSName(rc.Scratchpad) {
+				batch.Dispatchf("movetoworkspacesilent %s,address:%s", scratchWSName(rc.Scratchpad), win.Address)
+				handled = true
+			}
+		}
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("apply rules err: %s", err)
+	}
+
+	return handled
+}
+
+// unstack takes a window that a no_stack rule matched out of any
+// WindowOrder it is already in, putting it back as a plain tiled window.
+func (s *server) unstack(c *hyprctl.Client, win hyprctl.Window) {
+	wsState, _ := s.findInOrder(win.Address)
+	if wsState == nil {
+		return
+	}
+
+	s.dropFromOrder(c, wsState, win.Address)
+
+	if win.Workspace.Name == s.hiddenWSName(wsState.ID) {
+		c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %s,address:%s", wsState.selector(), win.Address))
+	} else if wsState.Layout == LayoutGrid {
+		c.DispatchRaw(fmt.Sprintf("settiled address:%s", win.Address))
+	}
+
+	s.saveState()
+}
+
+func (s *server) forgetRules(addr string) {
+	delete(s.rulesFired, addr)
+	delete(s.noStack, addr)
+	delete(s.ruleScratch, addr)
+	delete(s.ruleWindows, addr)
+}
+
+// handleTitleChange re-checks the rules, since a title rule may not have
+// matched when the window opened. Titles change often, so we only ask
+// Hyprland about the window once a rule that hasn't fired matches it.
+func (s *server) handleTitleChange(evt hyprctl.WindowTitleV2Event) {
+	rw, ok := s.ruleWindows[evt.Address]
+	if !ok {
+		// not opened yet as far as we know; openwindow checks the rules
+		return
+	}
+
+	pending := false
+	fired := s.rulesFired[evt.Address]
+	for i, rc := range s.cfg.Rules {
+		pending = pending || (!fired[i] && rw.match(rc, evt.Title))
+	}
+	if !pending {
+		return
+	}
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	win, ok := s.lookupWindow(c, evt.Address)
+	if !ok {
+		return
+	}
+
+	s.applyRules(c, win)
+}
+
+type ruleInfo struct {
+	Index int
+	Rule  config.RuleConfig
+	// Windows are the windows the rule has acted on
+	Windows []string
+}
+
+func (s *server) handleListRules(w http.ResponseWriter, r *http.Request) {
+	infos := make([]ruleInfo, 0, len(s.cfg.Rules))
+	for i, rc := range s.cfg.Rules {
+		info := ruleInfo{
+			Index:   i,
+			Rule:    rc,
+			Windows: []string{},
+		}
+		for addr, fired := range s.rulesFired {
+			if fired[i] {
+				info.Windows = append(info.Windows, addr)
+			}
+		}
+		sort.Strings(info.Windows)
+		infos = append(infos, info)
+	}
+
+	enc := json.NewEncoder(w)
+	if r.FormValue("p") != "" {
+		enc.SetIndent("", "  ")
+	}
+	enc.Encode(infos)
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/psanford/hypr-buddy/config"
+	"github.com/psanford/hypr-buddy/hyprctl"
+	"github.com/psanford/logmiddleware"
+)
+
+// scratchLaunchTimeout is how long an app -scratch started has to open its
+// window before we stop waiting for it.
+const scratchLaunchTimeout = time.Minute
+
+// handleScratch toggles a scratchpad. If it has no window the app is
+// started; otherwise the window is brought to the active workspace,
+// floating and centered, or hidden again if it is already there.
+//
+// A scratchpad's window is one we started for it, one a rule handed to
+// it, or whatever is parked on its special workspace. Other windows of
+// the same class are left alone, so a scratch terminal doesn't take over
+// the user's other terminals.
+func (s *server) handleScratch(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+	name := r.FormValue("name")
+
+	sc, ok := s.cfg.Scratchpads[name]
+	if !ok {
+		lgr.Error("unknown scratchpad", "name", name)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request unknown scratchpad %q", name)
+		return
+	}
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	wsInfo, err := c.ActiveWorkspace()
+	if err != nil {
+		panic(err)
+	}
+
+	area, ok := workspaceArea(c, wsInfo.ID)
+	if !ok {
+		lgr.Error("no monitor for workspace", "workspace", wsInfo.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "no monitor for workspace %d", wsInfo.ID)
+		return
+	}
+	width, height := scratchSize(sc, area)
+
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	var win *hyprctl.Window
+	for i, other := range allWindows {
+		owned := s.scratchWindows[other.Address] == name ||
+			s.ruleScratch[other.Address] == name ||
+			other.Workspace.Name == scratchWSName(name)
+		if !owned {
+			continue
+		}
+		// prefer a window that is already in view
+		if win == nil || other.Workspace.ID == wsInfo.ID {
+			win = &allWindows[i]
+		}
+	}
+
+	if win == nil {
+		if deadline, ok := s.scratchLaunches[name]; ok && time.Now().Before(deadline) {
+			log.Printf("scratchpad %s: still waiting for %s", name, sc.Command)
+			return
+		}
+
+		log.Printf("scratchpad %s: starting %s", name, sc.Command)
+		// exec rules can't go in a batch since they contain ';'
+		err := c.DispatchRaw(fmt.Sprintf("exec [float; size %d %d; center] %s", width, height, sc.Command))
+		if err != nil {
+			panic(err)
+		}
+		s.scratchLaunches[name] = time.Now().Add(scratchLaunchTimeout)
+		return
+	}
+
+	s.pushSnapshot()
+
+	if win.Workspace.ID == wsInfo.ID {
+		err := c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %s,address:%s", scratchWSName(name), win.Address))
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	wsState := s.getWSState(wsInfo.ID, wsInfo.Name)
+
+	// float it before moving so it doesn't join the workspace's layout
+	batch := c.Batch()
+	batch.Dispatchf("setfloating address:%s", win.Address)
+	batch.Dispatchf("resizewindowpixel exact %d %d,address:%s", width, height, win.Address)
+	batch.Dispatchf("movetoworkspacesilent %s,address:%s", wsState.selector(), win.Address)
+	batch.Dispatchf("movewindowpixel exact %d %d,address:%s", area.x+(area.w-width)/2, area.y+(area.h-height)/2, win.Address)
+	batch.Dispatchf("focuswindow address:%s", win.Address)
+	if _, err := batch.Run(); err != nil {
+		log.Printf("show scratchpad %s err: %s", name, err)
+	}
+}
+
+// scratchWindowOpened checks whether win is the window of an app -scratch
+// started, and if so gives it to that scratchpad. It reports whether it
+// did.
+func (s *server) scratchWindowOpened(win hyprctl.Window) bool {
+	for name, deadline := range s.scratchLaunches {
+		sc, ok := s.cfg.Scratchpads[name]
+		if !ok || time.Now().After(deadline) {
+			delete(s.scratchLaunches, name)
+			continue
+		}
+		if !sc.Match(win.Class, win.InitialClass, win.Title) {
+			continue
+		}
+
+		log.Printf("scratchpad %s: started as %s", name, win.Address)
+		delete(s.scratchLaunches, name)
+		s.scratchWindows[win.Address] = name
+		s.saveState()
+		return true
+	}
+	return false
+}
+
+// scratchWSName is where a scratchpad's window is kept while it is out of
+// view.
+func scratchWSName(name string) string {
+	return "special:scratch-" + name
+}
+
+func scratchSize(sc config.ScratchpadConfig, area rect) (int64, int64) {
+	width, height := sc.Width, sc.Height
+	if width == 0 {
+		width = area.w * 6 / 10
+	}
+	if height == 0 {
+		height = area.h * 6 / 10
+	}
+	return min(width, area.w), min(height, area.h)
+}
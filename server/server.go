@@ -1,7 +1,6 @@
 package server
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,9 +9,12 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/psanford/hypr-buddy/client"
@@ -22,85 +24,222 @@ import (
 )
 
 type server struct {
-	windowEvt chan HyprEvent
-	userEvt   chan string
+	windowEvt chan hyprctl.Event
+	userEvt   chan userCmd
 
 	handler http.Handler
 
-	spaces []*WorkspaceDesiredState
+	spaces map[int64]*WorkspaceDesiredState
+
+	cfg *config.Config
+
+	layouts []Layout
+
+	// activeProfile is the option profile applied with -profile, and
+	// profileSnapshot the original value of every option it changed
+	activeProfile   string
+	profileSnapshot map[string]string
+
+	// focusedWS and activeWindow track Hyprland's focus for /events
+	focusedWS    int64
+	activeWindow string
+
+	// mru is every window we've seen focused, most recent first.
+	// mruSettle is running while it is held after a daemon command.
+	mru        []string
+	mruSession *mruSession
+	mruSettle  *time.Timer
+
+	// undoHistory is the snapshots -undo restores, oldest first
+	undoHistory []*snapshot
+
+	// sessionRestore is the -restore-session still waiting for the
+	// apps it started, if any
+	sessionRestore *sessionRestore
+
+	// scratchWindows is the scratchpad each window -scratch started
+	// belongs to, and scratchLaunches when to stop waiting for the apps
+	// it has started but that haven't opened a window yet
+	scratchWindows  map[string]string
+	scratchLaunches map[string]time.Time
+
+	// rulesFired is the indexes of the rules that have acted on each
+	// window. noStack and ruleScratch are the windows rules kept out of
+	// the stack and handed to a scratchpad, and ruleWindows what rules
+	// match on for each window besides its title.
+	rulesFired  map[string]map[int]bool
+	noStack     map[string]bool
+	ruleScratch map[string]string
+	ruleWindows map[string]ruleWindow
+
+	// subs are the /events subscribers. Unlike everything else here
+	// they are also accessed from net/http goroutines.
+	subMu         sync.Mutex
+	subs          map[chan []byte]struct{}
+	lastPublished []byte
 }
 
 type WorkspaceDesiredState struct {
-	ID     int
+	ID     int64
+	Name   string
 	Layout LayoutMode
 
 	WindowOrder []string
+
+	// Masters, Orientation and MFact are the master layout settings for
+	// the workspace, applied whenever it goes back to the tiled layout.
+	// Masters <= 1 means one master, and an empty Orientation or zero
+	// MFact Hyprland's master:orientation or master:mfact.
+	Masters     int
+	Orientation string
+	MFact       float64
+}
+
+// selector is how dispatchers refer to this workspace. Named workspaces
+// have negative IDs, which dispatchers would treat as relative offsets.
+func (ws *WorkspaceDesiredState) selector() string {
+	if ws.ID > 0 || ws.Name == "" {
+		return strconv.FormatInt(ws.ID, 10)
+	}
+	return "name:" + ws.Name
 }
 
 type LayoutMode int
 
-var (
-	OpenWindowEvt  = "openwindow"
-	CloseWindowEvt = "closewindow"
-)
+// reconcileInterval is how often we check WindowOrder against the live
+// window list in case we missed an event.
+const reconcileInterval = 30 * time.Second
 
 const (
 	LayoutPrimaryWithStack LayoutMode = iota
 	LayoutSingleWindow
+	LayoutGrid
+	LayoutCentered
 )
 
+func (m LayoutMode) String() string {
+	switch m {
+	case LayoutPrimaryWithStack:
+		return "tiled"
+	case LayoutSingleWindow:
+		return "stacked"
+	case LayoutGrid:
+		return "grid"
+	case LayoutCentered:
+		return "centered"
+	}
+	return fmt.Sprintf("LayoutMode(%d)", int(m))
+}
+
 func New() *server {
 	s := &server{
-		windowEvt: make(chan HyprEvent),
-		userEvt:   make(chan string),
-		spaces:    make([]*WorkspaceDesiredState, 10), // 1 - 10
+		windowEvt: make(chan hyprctl.Event),
+		userEvt:   make(chan userCmd),
+		spaces:    make(map[int64]*WorkspaceDesiredState),
+		cfg:       config.Default(),
+		subs:      make(map[chan []byte]struct{}),
+
+		scratchWindows:  make(map[string]string),
+		scratchLaunches: make(map[string]time.Time),
+
+		rulesFired:  make(map[string]map[int]bool),
+		noStack:     make(map[string]bool),
+		ruleScratch: make(map[string]string),
+		ruleWindows: make(map[string]ruleWindow),
 	}
 
-	for i := 0; i < len(s.spaces); i++ {
-		s.spaces[i] = &WorkspaceDesiredState{
-			ID: i + 1,
-		}
+	// the order here is the order -layout-next cycles through
+	s.layouts = []Layout{
+		&masterLayout{s},
+		&stackedLayout{s},
+		&gridLayout{s},
+		&centeredLayout{s},
 	}
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/ping", s.handlePing)
-	mux.HandleFunc("/debug", s.handleDebugState)
-	mux.HandleFunc("/debug/state", s.handleDebugState)
-	mux.HandleFunc("/toggle-stack", s.handleToggleStack)
-	mux.HandleFunc("/focus", s.handleFocus)
-	mux.HandleFunc("/unhide-all", s.handleUnhideAll)
-	mux.HandleFunc("/toggle-bling", s.handleToggleBlingMode)
+	mux.HandleFunc("/debug", s.serialized(s.handleDebugState))
+	mux.HandleFunc("/debug/state", s.serialized(s.handleDebugState))
+	mux.HandleFunc("/toggle-stack", s.serialized(s.toggleLayout(LayoutSingleWindow)))
+	mux.HandleFunc("/toggle-grid", s.serialized(s.toggleLayout(LayoutGrid)))
+	mux.HandleFunc("/toggle-centered", s.serialized(s.toggleLayout(LayoutCentered)))
+	mux.HandleFunc("/layout", s.serialized(s.handleSetLayout))
+	mux.HandleFunc("/layout-next", s.serialized(s.handleNextLayout))
+	mux.HandleFunc("/master-grow", s.serialized(s.handleMasterGrow))
+	mux.HandleFunc("/mfact", s.serialized(s.handleMFact))
+	mux.HandleFunc("/master-count", s.serialized(s.handleMasterCount))
+	mux.HandleFunc("/orientation", s.serialized(s.handleOrientation))
+	mux.HandleFunc("/swap-master", s.serialized(s.handleSwapMaster))
+	mux.HandleFunc("/focus", s.serialized(s.handleFocus))
+	mux.HandleFunc("/focus-mru", s.serialized(s.handleFocusMRU))
+	mux.HandleFunc("/focus-window", s.serialized(s.handleFocusWindow))
+	mux.HandleFunc("/move-window", s.serialized(s.handleMoveWindow))
+	mux.HandleFunc("/windows", s.serialized(s.handleListWindows))
+	mux.HandleFunc("/unhide-all", s.serialized(s.handleUnhideAll))
+	mux.HandleFunc("/toggle-bling", s.serialized(s.handleToggleBlingMode))
+	mux.HandleFunc("/reconcile", s.serialized(s.handleReconcile))
+	mux.HandleFunc("/reload", s.serialized(s.handleReload))
+	mux.HandleFunc("/profile", s.serialized(s.handleProfile))
+	mux.HandleFunc("/profiles", s.serialized(s.handleListProfiles))
+	mux.HandleFunc("/scratch", s.serialized(s.handleScratch))
+	mux.HandleFunc("/undo", s.serialized(s.handleUndo))
+	mux.HandleFunc("/session", s.serialized(s.handleSaveSession))
+	mux.HandleFunc("/session/restore", s.serialized(s.handleRestoreSession))
+	mux.HandleFunc("/rules", s.serialized(s.handleListRules))
+	mux.HandleFunc("/events", s.handleEvents)
 
 	s.handler = logmiddleware.New(mux)
 
 	return s
 }
 
-type HyprEvent struct {
-	Name string
-	Data string
-}
-
 func (s *server) Serve(parentCtx context.Context) {
 	ctx, cancel := context.WithCancel(parentCtx)
 	defer cancel()
 
-	// unhide any previously hidden windows
-	s.unhideAll()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Printf("load config err: %s", err)
+	}
+	s.cfg = cfg
+
+	err = s.loadState()
+	if err != nil {
+		log.Printf("load state err: %s", err)
+	}
+
+	s.seedRules()
+
+	// restore stacked workspaces from a previous run and unhide
+	// anything we no longer know about
+	s.reconcileState()
+	s.updateFocusedWS()
+	s.seedMRU()
 
 	go func() {
 		err := s.acceptEventsFromHypr(ctx)
-		log.Fatal(err)
+		if ctx.Err() == nil {
+			log.Fatal(err)
+		}
 		cancel()
 	}()
 
 	go func() {
 		err := s.acceptUserEvents(ctx)
-		log.Fatal(err)
+		if ctx.Err() == nil {
+			log.Fatal(err)
+		}
 		cancel()
 	}()
 
+	reconcileTicker := time.NewTicker(reconcileInterval)
+	defer reconcileTicker.Stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
 OUTER:
 	for {
 		select {
@@ -109,26 +248,87 @@ OUTER:
 				break OUTER
 			}
 
-			if evt.Name == OpenWindowEvt {
-				parts := strings.SplitN(evt.Data, ",", 2)
-				s.handleWindowOpen("0x" + parts[0])
-
-			} else if evt.Name == CloseWindowEvt {
-				s.handleWindowClose("0x" + evt.Data)
-				//closewindow>>cdb5bd0
-
+			switch evt := evt.(type) {
+			case hyprctl.OpenWindowEvent:
+				s.handleWindowOpen(evt)
+			case hyprctl.CloseWindowEvent:
+				s.handleWindowClose(evt.Address)
+			case hyprctl.MoveWindowV2Event:
+				s.handleWindowMove(evt)
+			case hyprctl.ChangeFloatingModeEvent:
+				s.handleFloatingChange(evt)
+			case hyprctl.FullscreenEvent:
+				s.handleFullscreen(evt)
+			case hyprctl.WorkspaceV2Event:
+				s.handleWorkspaceFocus(evt)
+			case hyprctl.DestroyWorkspaceV2Event:
+				s.handleWorkspaceDestroy(evt)
+			case hyprctl.FocusedMonEvent:
+				s.updateFocusedWS()
+			case hyprctl.ActiveWindowV2Event:
+				s.noteActiveWindow(evt.Address)
+			case hyprctl.WindowTitleV2Event:
+				s.handleTitleChange(evt)
 			}
 
-			// log.Printf("window evt: %s %s", evt.Name, evt.Data)
-		case evt := <-s.userEvt:
-			log.Printf("user evt: %s", evt)
+			// log.Printf("window evt: %#v", evt)
+		case cmd := <-s.userEvt:
+			log.Printf("user evt: %s", cmd.name)
+			s.runUserCmd(cmd)
+			s.holdMRU()
+		case <-s.mruCommit():
+			s.commitMRU()
+		case <-s.mruSettled():
+			s.settleMRU()
+		case <-reconcileTicker.C:
+			s.periodicReconcile()
+		case <-hup:
+			log.Printf("SIGHUP, reloading config")
+			err := s.reloadConfig()
+			if err != nil {
+				log.Printf("reload config err: %s", err)
+			}
 		case <-ctx.Done():
 			log.Printf("ctx done: %s", ctx.Err())
 			break OUTER
 		}
+
+		s.publishState()
 	}
 }
 
+// userCmd is an HTTP handler invocation that has been handed to the
+// Serve goroutine. All reads and writes of s.spaces happen there, so user
+// commands and window events are applied one at a time, in order.
+type userCmd struct {
+	name string
+	run  func()
+	// done receives the recovered panic value, or nil, once run returns
+	done chan interface{}
+}
+
+// serialized wraps h so that it runs on the Serve goroutine. The calling
+// net/http goroutine blocks until h is finished with w.
+func (s *server) serialized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, _ := s.runOnLoop(r.Context(), r.URL.Path, func() {
+			h(w, r)
+		})
+		if p != nil {
+			// re-panic here so net/http reports it like any other
+			// handler panic
+			panic(p)
+		}
+	}
+}
+
+func (s *server) runUserCmd(cmd userCmd) {
+	defer func() {
+		cmd.done <- recover()
+	}()
+	cmd.run()
+}
+
 func (s *server) acceptUserEvents(parentCtx context.Context) error {
 	sockPath := config.SocketPath()
 
@@ -150,46 +350,38 @@ func (s *server) acceptUserEvents(parentCtx context.Context) error {
 	}
 	os.Chmod(config.SocketPath(), 0700)
 
-	return http.Serve(l, s.handler)
+	srv := &http.Server{
+		Handler: s.handler,
+	}
+
+	go func() {
+		<-parentCtx.Done()
+		srv.Close()
+	}()
+
+	return srv.Serve(l)
 }
 
 func (s *server) acceptEventsFromHypr(parentCtx context.Context) error {
 	ctx, cancel := context.WithCancel(parentCtx)
 	defer cancel()
 
-	path := config.HyprRuntimeDir() + ".socket2.sock"
-
-	conn, err := net.Dial("unix", path)
+	events, err := hyprctl.NewEventReader()
 	if err != nil {
 		return err
 	}
 
 	go func() {
 		<-ctx.Done()
-		conn.Close()
+		events.Close()
 	}()
 
-	r := bufio.NewReader(conn)
 	for {
-		b, err := r.ReadBytes('\n')
+		evt, err := events.Next()
 		if err != nil {
 			return err
 		}
 
-		line := string(b)
-		line = strings.TrimSpace(line)
-
-		parts := strings.SplitN(line, ">>", 2)
-		if len(parts) < 2 {
-			return fmt.Errorf("malformatted event line: <%s>", b)
-		}
-
-		event, data := parts[0], parts[1]
-		evt := HyprEvent{
-			Name: event,
-			Data: data,
-		}
-
 		select {
 		case s.windowEvt <- evt:
 		case <-ctx.Done():
@@ -207,70 +399,15 @@ func (s *server) handleDebugState(w http.ResponseWriter, r *http.Request) {
 	if r.FormValue("p") != "" {
 		enc.SetIndent("", "  ")
 	}
-	enc.Encode(s.spaces)
+	enc.Encode(s.sortedSpaces())
 }
 
-func (s *server) handleToggleStack(w http.ResponseWriter, r *http.Request) {
-	c, err := hyprctl.New()
-	if err != nil {
-		panic(err)
-	}
-
-	wsInfo, err := c.ActiveWorkspace()
-	if err != nil {
-		panic(err)
-	}
-
-	wsState := s.getWSStateByID(wsInfo.ID)
-
-	if wsState.Layout == LayoutSingleWindow {
-		wsState.Layout = LayoutPrimaryWithStack
-	} else {
-		wsState.Layout = LayoutSingleWindow
-	}
-
-	allWindows, err := c.Windows()
-	if err != nil {
-		panic(err)
-	}
-
-	sort.Sort(WindowSort(allWindows))
-
-	hiddenName := hiddenWSName(wsInfo.ID)
-
-	if wsState.Layout == LayoutSingleWindow {
-		windowOrder := make([]string, 0, 10)
-
-		wsWindows := make([]hyprctl.Window, 0, 10)
-		for _, w := range allWindows {
-			if w.Workspace.ID != wsInfo.ID {
-				continue
-			}
-
-			windowOrder = append(windowOrder, w.Address)
-			wsWindows = append(wsWindows, w)
-		}
-
-		// move all the windows except the master to the shadow workspace
-		for _, w := range wsWindows[1:] {
-			c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %s,address:%s", hiddenName, w.Address))
-		}
-
-		wsState.WindowOrder = windowOrder
-
-	} else {
-		for _, w := range allWindows {
-			if w.Workspace.Name != hiddenName {
-				continue
-			}
-
-			c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %d,address:%s", wsInfo.ID, w.Address))
-		}
-		s.moveWindowsToOrder(c, wsInfo, wsState.WindowOrder)
-	}
+func (s *server) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	s.reconcileState()
 }
 
 func (s *server) handleUnhideAll(w http.ResponseWriter, r *http.Request) {
+	s.pushSnapshot()
 	s.unhideAll()
 }
 
@@ -293,30 +430,35 @@ func (s *server) unhideAll() {
 	}
 
 	for _, ws := range workspaces {
-		if ws.ID < 0 {
+		if isSpecialWS(ws.Name) {
 			continue
 		}
-		wsState := s.getWSStateByID(ws.ID)
+		wsState := s.getWSState(ws.ID, ws.Name)
 
 		if wsState.Layout == LayoutSingleWindow {
 			wsState.Layout = LayoutPrimaryWithStack
 		}
 
-		hiddenName := hiddenWSName(ws.ID)
+		hiddenName := s.hiddenWSName(ws.ID)
 
-		var didMove bool
+		batch := c.Batch()
 		for _, w := range allWindows {
 			if w.Workspace.Name != hiddenName {
 				continue
 			}
 
-			c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %d,address:%s", ws.ID, w.Address))
-			didMove = true
+			batch.Dispatchf("movetoworkspacesilent %s,address:%s", wsState.selector(), w.Address)
+		}
+		didMove := batch.Len() > 0
+		if _, err := batch.Run(); err != nil {
+			log.Printf("unhide windows err: %s", err)
 		}
 		if didMove && len(wsState.WindowOrder) > 0 {
 			s.moveWindowsToOrder(c, &ws, wsState.WindowOrder)
 		}
 	}
+
+	s.saveState()
 }
 
 func (s *server) handleToggleBlingMode(w http.ResponseWriter, r *http.Request) {
@@ -332,30 +474,17 @@ func (s *server) handleToggleBlingMode(w http.ResponseWriter, r *http.Request) {
 
 	animationsEnabled := opt.Int == 1
 
-	type Opt struct {
-		Name string
-		Val  string
-	}
-
-	var cmds []Opt
+	opts := s.cfg.Bling.On
 	if animationsEnabled {
-		cmds = []Opt{
-			{"animations:enabled", "no"},
-			{"general:gaps_in", "0"},
-			{"general:gaps_out", "0"},
-			{"decoration:rounding", "0"},
-		}
-	} else {
-		cmds = []Opt{
-			{"animations:enabled", "yes"},
-			{"general:gaps_in", "5"},
-			{"general:gaps_out", "20"},
-			{"decoration:rounding", "10"},
-		}
+		opts = s.cfg.Bling.Off
 	}
 
-	for _, cmd := range cmds {
-		c.SetOption(cmd.Name, cmd.Val)
+	batch := c.Batch()
+	for _, name := range sortedKeys(opts) {
+		batch.SetOption(name, opts[name])
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("set bling options err: %s", err)
 	}
 }
 
@@ -375,6 +504,7 @@ func (s *server) moveWindowsToOrder(c *hyprctl.Client, wsInfo *hyprctl.Workspace
 		wsWindows = append(wsWindows, w)
 	}
 
+	batch := c.Batch()
 	for i, addr := range desiredOrder {
 		startIdx := -100
 		for j := 0; j < len(wsWindows); j++ {
@@ -395,8 +525,8 @@ func (s *server) moveWindowsToOrder(c *hyprctl.Client, wsInfo *hyprctl.Workspace
 		moveAmt *= -1
 
 		for n := 0; n < moveAmt; n++ {
-			c.DispatchRaw(fmt.Sprintf("focuswindow address:%s", addr))
-			c.DispatchRaw("layoutmsg swapprev")
+			batch.Dispatchf("focuswindow address:%s", addr)
+			batch.Dispatch("layoutmsg swapprev")
 
 			log.Printf("swap %d %d", startIdx-n, startIdx-n-1)
 			wsWindows[startIdx-n], wsWindows[startIdx-n-1] = wsWindows[startIdx-n-1], wsWindows[startIdx-n]
@@ -404,7 +534,11 @@ func (s *server) moveWindowsToOrder(c *hyprctl.Client, wsInfo *hyprctl.Workspace
 	}
 
 	if len(desiredOrder) > 0 {
-		c.DispatchRaw(fmt.Sprintf("focuswindow address:%s", desiredOrder[0]))
+		batch.Dispatchf("focuswindow address:%s", desiredOrder[0])
+	}
+
+	if _, err := batch.Run(); err != nil {
+		log.Printf("reorder windows err: %s", err)
 	}
 }
 
@@ -423,161 +557,153 @@ func (s *server) handleFocus(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	s.pushSnapshot()
+
 	c, err := hyprctl.New()
 	if err != nil {
 		panic(err)
 	}
 
-	wsInfo, err := c.ActiveWorkspace()
-	if err != nil {
-		panic(err)
-	}
+	wsState := s.activeWSState(c)
+	s.layout(wsState.Layout).Focus(c, wsState, n)
+}
 
-	wsState := s.getWSStateByID(wsInfo.ID)
+func (s *server) handleWindowOpen(evt hyprctl.OpenWindowEvent) {
+	id := evt.Address
+	log.Printf("evt window open %s on %s", id, evt.Workspace)
 
-	allWindows, err := c.Windows()
+	c, err := hyprctl.New()
 	if err != nil {
 		panic(err)
 	}
 
-	sort.Sort(WindowSort(allWindows))
-
-	windowsByID := make(map[string]hyprctl.Window)
-	windowNames := make(map[string]string)
-	for _, w := range allWindows {
-		windowNames[w.Address] = fmt.Sprintf("[%s/%s]", w.InitialClass, w.InitialTitle)
-		windowsByID[w.Address] = w
+	// look the window up rather than trusting the focused workspace; on a
+	// multi-monitor setup windows can open on an unfocused monitor
+	win, ok := s.lookupWindow(c, id)
+	if !ok {
+		return
 	}
 
-	hiddenName := hiddenWSName(wsInfo.ID)
-
-	if wsState.Layout == LayoutPrimaryWithStack {
-		cmd := "layoutmsg cyclenext"
-		if n < 0 {
-			cmd = "layoutmsg cycleprev"
-		}
-		log.Printf("Multi layout, cmd: %s", cmd)
-		c.DispatchRaw(cmd)
-	} else {
-		if len(wsState.WindowOrder) < 2 {
-			log.Printf("window order < 2, nothing to toggle")
-			return
-		}
-
-		oldMaster := wsState.WindowOrder[0]
-
-		var newMaster string
-		newOrder := make([]string, len(wsState.WindowOrder))
-		if n < 0 { // cycle prev
-			newMaster = wsState.WindowOrder[len(wsState.WindowOrder)-1]
+	if s.applyRules(c, win) {
+		// a rule moved or floated it; we'll get events for that
+		return
+	}
 
-			// before:
-			// [a, b, c, d, e]
-			// after:
-			// [e, a, b, c, d]
+	if s.sessionWindowOpened(c, win) || s.scratchWindowOpened(win) {
+		return
+	}
 
-			newOrder[0] = newMaster
-			newOrder[1] = oldMaster
-			if len(wsState.WindowOrder) > 2 {
-				copy(newOrder[2:], wsState.WindowOrder[1:len(wsState.WindowOrder)-1])
-			}
+	if wsState, _ := s.findInOrder(id); wsState != nil {
+		// already picked up by a reconcile pass
+		return
+	}
 
-		} else { // cycle next
-			newMaster = wsState.WindowOrder[1]
+	if win.Floating || s.noStack[id] {
+		// floating windows are not part of the stack
+		return
+	}
 
-			// before:
-			// [a, b, c, d, e]
-			// after:
-			// [b, c, d, e, a]
+	if isSpecialWS(win.Workspace.Name) {
+		return
+	}
 
-			copy(newOrder, wsState.WindowOrder[1:])
-			newOrder[len(newOrder)-1] = oldMaster
-		}
+	wsState := s.getWSState(win.Workspace.ID, win.Workspace.Name)
 
-		wsState.WindowOrder = newOrder
+	if s.layout(wsState.Layout).WindowOpened(c, wsState, id) {
+		s.saveState()
+	}
+}
 
-		c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %d,address:%s", wsInfo.ID, newMaster))
+func (s *server) handleWindowClose(id string) {
+	log.Printf("evt window close %s", id)
 
-		c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %s,address:%s", hiddenName, oldMaster))
+	s.forgetWindow(id)
+	s.forgetRules(id)
+	if _, ok := s.scratchWindows[id]; ok {
+		delete(s.scratchWindows, id)
+		s.saveState()
 	}
-}
 
-func (s *server) handleWindowOpen(id string) {
-	log.Printf("evt window open %s", id)
 	c, err := hyprctl.New()
 	if err != nil {
 		panic(err)
 	}
 
-	wsInfo, err := c.ActiveWorkspace()
-	if err != nil {
-		panic(err)
+	if wsState, _ := s.findInOrder(id); wsState != nil {
+		s.dropFromOrder(c, wsState, id)
+		s.saveState()
 	}
 
-	wsState := s.getWSStateByID(wsInfo.ID)
+	s.clampMasters(c)
+}
 
-	if wsState.Layout != LayoutSingleWindow {
-		return
+// getWSState returns the desired state for a workspace, creating it on
+// first use. A non-empty name replaces the stored one, since named
+// workspaces can be renamed.
+func (s *server) getWSState(id int64, name string) *WorkspaceDesiredState {
+	wsState := s.spaces[id]
+	if wsState == nil {
+		wsState = &WorkspaceDesiredState{
+			ID: id,
+		}
+		s.spaces[id] = wsState
 	}
-
-	allWindows, err := c.Windows()
-	if err != nil {
-		panic(err)
+	if name != "" {
+		wsState.Name = name
 	}
+	return wsState
+}
 
-	sort.Sort(WindowSort(allWindows))
-
-	for _, w := range allWindows {
-		if w.Address == id {
-			if w.Floating {
-				// floating windows are not part of the stack
-				return
-			}
-		}
+// lookupWSState returns the desired state for a workspace without
+// creating it, for callers that only read it. Workspaces we have no state
+// for are tiled.
+func (s *server) lookupWSState(id int64) *WorkspaceDesiredState {
+	if wsState := s.spaces[id]; wsState != nil {
+		return wsState
 	}
+	return &WorkspaceDesiredState{ID: id}
+}
 
-	if len(wsState.WindowOrder) > 0 {
-		oldMaster := wsState.WindowOrder[0]
-		hiddenName := hiddenWSName(wsInfo.ID)
-		c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %s,address:%s", hiddenName, oldMaster))
+// handleWorkspaceDestroy forgets the state of a workspace Hyprland has
+// destroyed, so the state file doesn't grow forever. A workspace that
+// still has windows parked on its hidden workspace is kept so they can be
+// brought back.
+func (s *server) handleWorkspaceDestroy(evt hyprctl.DestroyWorkspaceV2Event) {
+	if _, ok := s.spaces[evt.ID]; !ok {
+		return
 	}
 
-	wsState.WindowOrder = append([]string{id}, wsState.WindowOrder...)
-}
-
-func (s *server) handleWindowClose(id string) {
-	log.Printf("evt window close %s", id)
 	c, err := hyprctl.New()
 	if err != nil {
 		panic(err)
 	}
 
-	wsInfo, err := c.ActiveWorkspace()
+	allWindows, err := c.Windows()
 	if err != nil {
 		panic(err)
 	}
 
-	wsState := s.getWSStateByID(wsInfo.ID)
-
-	if wsState.Layout != LayoutSingleWindow {
-		return
-	}
-
-	if len(wsState.WindowOrder) < 2 {
-		return
-	}
-
-	if wsState.WindowOrder[0] != id {
-		return
+	hiddenName := s.hiddenWSName(evt.ID)
+	for _, w := range allWindows {
+		if w.Workspace.Name == hiddenName {
+			return
+		}
 	}
 
-	wsState.WindowOrder = wsState.WindowOrder[1:]
-
-	c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %d,address:%s", wsInfo.ID, wsState.WindowOrder[0]))
+	log.Printf("evt workspace destroyed %d (%s)", evt.ID, evt.Name)
+	delete(s.spaces, evt.ID)
+	s.saveState()
 }
 
-func (s *server) getWSStateByID(id int64) *WorkspaceDesiredState {
-	return s.spaces[int(id)-1]
+func (s *server) sortedSpaces() []*WorkspaceDesiredState {
+	spaces := make([]*WorkspaceDesiredState, 0, len(s.spaces))
+	for _, wsState := range s.spaces {
+		spaces = append(spaces, wsState)
+	}
+	sort.Slice(spaces, func(i, j int) bool {
+		return spaces[i].ID < spaces[j].ID
+	})
+	return spaces
 }
 
 // Sorts windows by Workspace and then by order on a workspace
@@ -607,6 +733,25 @@ func (w WindowSort) Swap(i, j int) {
 	w[i], w[j] = w[j], w[i]
 }
 
-func hiddenWSName(id int64) string {
-	return fmt.Sprintf("special:hidden-%d", id)
+func (s *server) hiddenWSName(id int64) string {
+	return fmt.Sprintf(s.cfg.Stack.HiddenWorkspace, id)
+}
+
+// parseHiddenWSName returns the workspace ID a hidden workspace belongs to.
+func (s *server) parseHiddenWSName(name string) (int64, bool) {
+	return parseHiddenWSNameFormat(s.cfg.Stack.HiddenWorkspace, name)
+}
+
+func parseHiddenWSNameFormat(format, name string) (int64, bool) {
+	var id int64
+	_, err := fmt.Sscanf(name, format, &id)
+	if err != nil {
+		return 0, false
+	}
+	// Sscanf ignores trailing input, so check for an exact match
+	return id, fmt.Sprintf(format, id) == name
+}
+
+func isSpecialWS(name string) bool {
+	return strings.HasPrefix(name, "special:")
 }
@@ -0,0 +1,795 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/psanford/hypr-buddy/client"
+	"github.com/psanford/hypr-buddy/hyprctl"
+	"github.com/psanford/hypr-buddy/hyprtest"
+)
+
+// newHypr starts a fake Hyprland with windows a, b and c open on
+// workspace 1. The newest window is master, so they are tiled c, b, a.
+func newHypr(t *testing.T) (h *hyprtest.Server, a, b, c string) {
+	t.Helper()
+
+	h = hyprtest.NewServer()
+	t.Cleanup(h.Close)
+	h.Setenv(t)
+
+	a = h.OpenWindow(hyprtest.WindowSpec{Class: "a"})
+	b = h.OpenWindow(hyprtest.WindowSpec{Class: "b"})
+	c = h.OpenWindow(hyprtest.WindowSpec{Class: "c"})
+	return h, a, b, c
+}
+
+// startDaemon runs the daemon against h until the test finishes.
+func startDaemon(t *testing.T) *client.Client {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		New().Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	c := client.NewClient()
+	for i := 0; c.Ping() != nil; i++ {
+		if i > 200 {
+			t.Fatal("daemon did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return c
+}
+
+// wsWindows returns the addresses of the windows on the named workspace,
+// in tiling order.
+func wsWindows(h *hyprtest.Server, name string) []string {
+	var windows []hyprctl.Window
+	for _, w := range h.Windows() {
+		if w.Workspace.Name == name {
+			windows = append(windows, w)
+		}
+	}
+	sort.Sort(WindowSort(windows))
+
+	addrs := []string{}
+	for _, w := range windows {
+		addrs = append(addrs, w.Address)
+	}
+	return addrs
+}
+
+func checkWindows(t *testing.T, h *hyprtest.Server, visible, hidden []string) {
+	t.Helper()
+
+	if got := wsWindows(h, "1"); !reflect.DeepEqual(got, visible) {
+		t.Errorf("workspace 1 windows = %v, want %v", got, visible)
+	}
+
+	// hidden windows are checked as a set; their order is the daemon's
+	hidden = append([]string{}, hidden...)
+	sort.Strings(hidden)
+	got := wsWindows(h, "special:hidden-1")
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, hidden) {
+		t.Errorf("hidden windows = %v, want %v", got, hidden)
+	}
+}
+
+func TestToggleStack(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	bud := startDaemon(t)
+
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	checkWindows(t, h, []string{c}, []string{a, b})
+
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	checkWindows(t, h, []string{c, b, a}, nil)
+}
+
+func TestFocusCycle(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	bud := startDaemon(t)
+
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		focus  func() error
+		master string
+	}{
+		{bud.FocusNext, b},
+		{bud.FocusNext, a},
+		{bud.FocusNext, c},
+		{bud.FocusPrev, a},
+		{bud.FocusPrev, b},
+	}
+	for i, step := range steps {
+		if err := step.focus(); err != nil {
+			t.Fatal(err)
+		}
+
+		var hidden []string
+		for _, addr := range []string{a, b, c} {
+			if addr != step.master {
+				hidden = append(hidden, addr)
+			}
+		}
+		checkWindows(t, h, []string{step.master}, hidden)
+		if got := h.ActiveWindow(); got != step.master {
+			t.Errorf("step %d: active window = %s, want %s", i, got, step.master)
+		}
+	}
+}
+
+func TestUnhideAll(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	bud := startDaemon(t)
+
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bud.FocusNext(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bud.UnhideAll(); err != nil {
+		t.Fatal(err)
+	}
+	// windows come back in stack order, starting from the master
+	checkWindows(t, h, []string{b, a, c}, nil)
+}
+
+func TestWorkspaceDestroy(t *testing.T) {
+	h, _, _, _ := newHypr(t)
+	d := h.OpenWindow(hyprtest.WindowSpec{Class: "d", Workspace: "2"})
+	bud := startDaemon(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sub, err := bud.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	hasWS2 := func(st *client.State) bool {
+		for _, ws := range st.Workspaces {
+			if ws.ID == 2 {
+				return true
+			}
+		}
+		return false
+	}
+
+	st, err := sub.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasWS2(st) {
+		t.Fatalf("no state for workspace 2 at startup: %+v", st)
+	}
+
+	h.CloseWindow(d)
+	for hasWS2(st) {
+		st, err = sub.Next()
+		if err != nil {
+			t.Fatalf("workspace 2 state not dropped: %s", err)
+		}
+	}
+}
+
+func TestGrid(t *testing.T) {
+	h, _, _, _ := newHypr(t)
+	bud := startDaemon(t)
+
+	if err := bud.ToggleGrid(); err != nil {
+		t.Fatal(err)
+	}
+
+	windows := h.Windows()
+	for i, w := range windows {
+		if !w.Floating {
+			t.Errorf("window %s not floating in grid", w.Address)
+		}
+		for _, other := range windows[i+1:] {
+			if w.At[0] < other.At[0]+other.Size[0] && other.At[0] < w.At[0]+w.Size[0] &&
+				w.At[1] < other.At[1]+other.Size[1] && other.At[1] < w.At[1]+w.Size[1] {
+				t.Errorf("windows %s %v%v and %s %v%v overlap", w.Address, w.At, w.Size, other.Address, other.At, other.Size)
+			}
+		}
+	}
+
+	if err := bud.ToggleGrid(); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range h.Windows() {
+		if w.Floating {
+			t.Errorf("window %s still floating after leaving grid", w.Address)
+		}
+	}
+}
+
+func TestCentered(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	bud := startDaemon(t)
+
+	if err := bud.ToggleCentered(); err != nil {
+		t.Fatal(err)
+	}
+	// the master goes in the middle and the stack alternates right, left
+	checkWindows(t, h, []string{a, c, b}, nil)
+
+	if err := bud.ToggleCentered(); err != nil {
+		t.Fatal(err)
+	}
+	checkWindows(t, h, []string{c, b, a}, nil)
+}
+
+func TestUndo(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	bud := startDaemon(t)
+
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bud.FocusNext(); err != nil {
+		t.Fatal(err)
+	}
+	// rejected commands are not undone
+	if err := bud.SetLayout("bogus"); err == nil {
+		t.Fatal("SetLayout(bogus) succeeded")
+	}
+	if err := bud.UnhideAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := h.OpenWindow(hyprtest.WindowSpec{Class: "d"})
+
+	if err := bud.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	// d opened after the snapshot, so it goes to the back of the stack
+	// and is hidden
+	checkWindows(t, h, []string{b}, []string{a, c, d})
+	if err := bud.FocusPrev(); err != nil {
+		t.Fatal(err)
+	}
+	checkWindows(t, h, []string{d}, []string{a, b, c})
+
+	// focus cycling is undone like any other change to the stack
+	if err := bud.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	checkWindows(t, h, []string{b}, []string{a, c, d})
+	if err := bud.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	checkWindows(t, h, []string{c}, []string{a, b, d})
+
+	if err := bud.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if got := wsWindows(h, "1"); len(got) != 4 {
+		t.Errorf("workspace 1 windows = %v, want all 4", got)
+	}
+
+	if err := bud.Undo(); err == nil {
+		t.Error("undo with empty history succeeded")
+	}
+}
+
+// waitState waits for the daemon to publish a state that ok accepts.
+func waitState(t *testing.T, bud *client.Client, ok func(*client.State) bool) *client.State {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sub, err := bud.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	for {
+		st, err := sub.Next()
+		if err != nil {
+			t.Fatalf("wait for state: %s", err)
+		}
+		if ok(st) {
+			return st
+		}
+	}
+}
+
+func TestRestoreSession(t *testing.T) {
+	h, a, b, c := newHypr(t)
+
+	writeConfig(t, "[session.commands]\na = \"start-a\"\n")
+
+	launched := make(chan string, 1)
+	h.OnExec = func(cmd string) {
+		launched <- h.OpenWindow(hyprtest.WindowSpec{Class: "a"})
+	}
+
+	bud := startDaemon(t)
+
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bud.FocusNext(); err != nil {
+		t.Fatal(err)
+	}
+	sess, err := bud.SaveSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.CloseWindow(a)
+
+	// a workspace that isn't in the session keeps its layout
+	h.Dispatch("workspace 3")
+	h.OpenWindow(hyprtest.WindowSpec{Class: "e", Workspace: "3"})
+	h.OpenWindow(hyprtest.WindowSpec{Class: "f", Workspace: "3"})
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	h.Dispatch("workspace 1")
+
+	result, err := bud.RestoreSession(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Launched, []string{"a"}) {
+		t.Fatalf("launched = %v, want [a]", result.Launched)
+	}
+
+	var newA string
+	select {
+	case newA = <-launched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a was not started")
+	}
+
+	want := []string{b, newA, c}
+	waitState(t, bud, func(st *client.State) bool {
+		for _, ws := range st.Workspaces {
+			if ws.ID == 1 {
+				return ws.Layout == "stacked" && reflect.DeepEqual(ws.Windows, want)
+			}
+		}
+		return false
+	})
+	checkWindows(t, h, []string{b}, []string{newA, c})
+
+	st := waitState(t, bud, func(*client.State) bool { return true })
+	for _, ws := range st.Workspaces {
+		if ws.ID == 3 && ws.Layout != "stacked" {
+			t.Errorf("workspace 3 layout = %s, want stacked", ws.Layout)
+		}
+	}
+}
+
+// writeConfig writes the daemon's config file.
+func writeConfig(t *testing.T, cfg string) {
+	t.Helper()
+
+	dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "hypr-buddy")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// findWindow returns the window with address addr.
+func findWindow(h *hyprtest.Server, addr string) hyprctl.Window {
+	for _, w := range h.Windows() {
+		if w.Address == addr {
+			return w
+		}
+	}
+	return hyprctl.Window{}
+}
+
+func TestRuleOnTitleChange(t *testing.T) {
+	h, _, _, _ := newHypr(t)
+	writeConfig(t, "[[rules]]\ntitle = \"^secret\"\npin = true\n")
+	bud := startDaemon(t)
+
+	d := h.OpenWindow(hyprtest.WindowSpec{Class: "d", Title: "hello"})
+	if err := h.SetTitle(d, "secret notes"); err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the daemon to have handled the title change
+	if err := bud.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; !findWindow(h, d).Pinned; i++ {
+		if i > 200 {
+			t.Fatal("window not pinned after title change")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if w := findWindow(h, d); !w.Floating {
+		t.Errorf("pinned window not floating")
+	}
+}
+
+func TestReloadRules(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	bud := startDaemon(t)
+
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(t, "[[rules]]\nclass = \"^b$\"\nno_stack = true\n")
+	if err := bud.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := wsWindows(h, "1"); !sameSet(got, []string{b, c}) {
+		t.Errorf("workspace 1 windows = %v, want %v", got, []string{b, c})
+	}
+	if got := wsWindows(h, "special:hidden-1"); !reflect.DeepEqual(got, []string{a}) {
+		t.Errorf("hidden windows = %v, want %v", got, []string{a})
+	}
+}
+
+func TestMastersClampedOnClose(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	bud := startDaemon(t)
+
+	for i := 0; i < 2; i++ {
+		if err := bud.AddMaster(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.CloseWindow(a)
+
+	// with both remaining windows masters this is a no-op; a stale
+	// count of 3 would take one away
+	if err := bud.AddMaster(); err != nil {
+		t.Fatal(err)
+	}
+	if wb, wc := findWindow(h, b), findWindow(h, c); wb.At[0] != wc.At[0] {
+		t.Errorf("b at %v and c at %v, want both in the master column", wb.At, wc.At)
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	bud := startDaemon(t)
+
+	// the master goes in the middle and the stack alternates right, left
+	if err := bud.SetOrientation("center"); err != nil {
+		t.Fatal(err)
+	}
+	checkWindows(t, h, []string{a, c, b}, nil)
+
+	// kept across stacking and unstacking
+	for i := 0; i < 2; i++ {
+		if err := bud.ToggleStack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkWindows(t, h, []string{a, c, b}, nil)
+
+	if err := bud.SetOrientation("left"); err != nil {
+		t.Fatal(err)
+	}
+	checkWindows(t, h, []string{c, b, a}, nil)
+
+	if err := bud.SetOrientation("diagonal"); err == nil {
+		t.Error("SetOrientation(diagonal) succeeded")
+	}
+}
+
+func TestMasterGrow(t *testing.T) {
+	h, _, _, _ := newHypr(t)
+	bud := startDaemon(t)
+
+	// the last mfact sent to Hyprland
+	lastMFact := func() string {
+		t.Helper()
+		reqs := h.Requests()
+		for i := len(reqs) - 1; i >= 0; i-- {
+			if _, v, ok := strings.Cut(reqs[i], "layoutmsg mfact exact "); ok {
+				v, _, _ = strings.Cut(v, ";")
+				return v
+			}
+		}
+		t.Fatal("no mfact sent")
+		return ""
+	}
+
+	steps := []struct {
+		name string
+		do   func() error
+		want string
+	}{
+		// from Hyprland's default of 0.55
+		{"grow", func() error { return bud.MasterGrow(0.1) }, "0.650"},
+		{"grow again", func() error { return bud.MasterGrow(0.1) }, "0.750"},
+		{"shrink", func() error { return bud.MasterGrow(-0.2) }, "0.550"},
+		{"set", func() error { return bud.SetMFact(0.3) }, "0.300"},
+		{"grow from set", func() error { return bud.MasterGrow(0.1) }, "0.400"},
+		{"set zero clamps", func() error { return bud.SetMFact(0) }, "0.050"},
+		{"shrink clamps", func() error { return bud.MasterGrow(-0.1) }, "0.050"},
+		{"grow clamps", func() error { return bud.MasterGrow(2) }, "0.950"},
+	}
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: %s", step.name, err)
+		}
+		if got := lastMFact(); got != step.want {
+			t.Errorf("%s: mfact = %s, want %s", step.name, got, step.want)
+		}
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	h, _, _, _ := newHypr(t)
+
+	writeConfig(t, `
+[profiles.focus]
+"general:gaps_in" = "0"
+"general:gaps_out" = "0"
+
+[profiles.present]
+"general:gaps_in" = "10"
+"decoration:rounding" = "0"
+`)
+
+	bud := startDaemon(t)
+
+	checkOptions := func(want map[string]string) {
+		t.Helper()
+		for name, val := range want {
+			opt, err := h.Client().GetOption(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := opt.Value(); got != val {
+				t.Errorf("%s = %q, want %q", name, got, val)
+			}
+		}
+	}
+
+	if err := bud.SetProfile("focus"); err != nil {
+		t.Fatal(err)
+	}
+	checkOptions(map[string]string{
+		"general:gaps_in":     "0",
+		"general:gaps_out":    "0",
+		"decoration:rounding": "10",
+	})
+
+	// gaps_out goes back to its original value, not the one from focus
+	if err := bud.SetProfile("present"); err != nil {
+		t.Fatal(err)
+	}
+	checkOptions(map[string]string{
+		"general:gaps_in":     "10",
+		"general:gaps_out":    "20",
+		"decoration:rounding": "0",
+	})
+
+	list, err := bud.Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Active != "present" {
+		t.Errorf("active profile = %q, want present", list.Active)
+	}
+
+	if err := bud.SetProfile("restore"); err != nil {
+		t.Fatal(err)
+	}
+	checkOptions(map[string]string{
+		"general:gaps_in":     "5",
+		"general:gaps_out":    "20",
+		"decoration:rounding": "10",
+	})
+
+	if err := bud.SetProfile("nope"); err == nil {
+		t.Error("SetProfile(nope) succeeded")
+	}
+}
+
+func TestScratchpad(t *testing.T) {
+	h, _, _, _ := newHypr(t)
+
+	writeConfig(t, "[scratchpads.term]\ncommand = \"term\"\nclass = \"^term$\"\n")
+
+	var execs atomic.Int32
+	launched := make(chan string, 2)
+	h.OnExec = func(cmd string) {
+		execs.Add(1)
+		launched <- h.OpenWindow(hyprtest.WindowSpec{Class: "term", Floating: true})
+	}
+
+	// the user's own terminal must not be taken over
+	mine := h.OpenWindow(hyprtest.WindowSpec{Class: "term"})
+
+	bud := startDaemon(t)
+
+	if err := bud.Scratch("term"); err != nil {
+		t.Fatal(err)
+	}
+	var scratch string
+	select {
+	case scratch = <-launched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scratchpad app not started")
+	}
+
+	// toggling hides it once the daemon has seen it open; until then
+	// the launch is still pending and nothing happens
+	for i := 0; findWindow(h, scratch).Workspace.Name != "special:scratch-term"; i++ {
+		if i > 200 {
+			t.Fatal("scratchpad window not hidden")
+		}
+		if err := bud.Scratch("term"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := execs.Load(); n != 1 {
+		t.Errorf("started %d times, want 1", n)
+	}
+	if got := findWindow(h, mine).Workspace.Name; got != "1" {
+		t.Errorf("terminal on %q, want 1", got)
+	}
+
+	if err := bud.Scratch("term"); err != nil {
+		t.Fatal(err)
+	}
+	if w := findWindow(h, scratch); w.Workspace.Name != "1" || !w.Floating {
+		t.Errorf("scratchpad on %q floating %t, want floating on 1", w.Workspace.Name, w.Floating)
+	}
+	if got := findWindow(h, mine).Workspace.Name; got != "1" {
+		t.Errorf("terminal on %q, want 1", got)
+	}
+}
+
+func TestFocusMRU(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	bud := startDaemon(t)
+
+	// the user works in b, then a
+	for _, addr := range []string{b, a} {
+		h.Dispatch("focuswindow address:" + addr)
+		time.Sleep(2 * mruSettleDelay)
+	}
+
+	// stacking and unstacking focuses windows as they are rearranged,
+	// which doesn't count as using them
+	for i := 0; i < 2; i++ {
+		if err := bud.ToggleStack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.Dispatch("focuswindow address:" + a)
+	time.Sleep(2 * mruSettleDelay)
+
+	// repeated presses go further back through the history
+	for _, want := range []string{b, c} {
+		if err := bud.FocusMRU(); err != nil {
+			t.Fatal(err)
+		}
+		if got := h.ActiveWindow(); got != want {
+			t.Errorf("active window = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestFocusWindow(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	bud := startDaemon(t)
+
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stack is c, b, a; focusing a rotates it to a, c, b
+	if err := bud.FocusWindow(a); err != nil {
+		t.Fatal(err)
+	}
+	checkWindows(t, h, []string{a}, []string{b, c})
+	if got := h.ActiveWindow(); got != a {
+		t.Errorf("active window = %s, want %s", got, a)
+	}
+
+	infos, err := bud.Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, info := range infos {
+		if info.WorkspaceName != "1" {
+			t.Errorf("%s listed on %q, want 1", info.Address, info.WorkspaceName)
+		}
+		if want := info.Address != a; info.Hidden != want {
+			t.Errorf("%s hidden = %t, want %t", info.Address, info.Hidden, want)
+		}
+		got = append(got, info.Address)
+	}
+	if want := []string{a, c, b}; !reflect.DeepEqual(got, want) {
+		t.Errorf("windows = %v, want %v", got, want)
+	}
+
+	// rotated rather than swapped, so the next window is still c
+	if err := bud.FocusNext(); err != nil {
+		t.Fatal(err)
+	}
+	checkWindows(t, h, []string{c}, []string{a, b})
+
+	if err := bud.FocusWindow("0xdead"); err == nil {
+		t.Error("FocusWindow(0xdead) succeeded")
+	}
+}
+
+func TestMoveWindowStacked(t *testing.T) {
+	h, a, b, c := newHypr(t)
+	e := h.OpenWindow(hyprtest.WindowSpec{Class: "e", Workspace: "2"})
+	f := h.OpenWindow(hyprtest.WindowSpec{Class: "f", Workspace: "2"})
+	bud := startDaemon(t)
+
+	// stack both workspaces: 2 shows f and 1 shows c
+	h.Dispatch("workspace 2")
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	h.Dispatch("workspace 1")
+	if err := bud.ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	h.Dispatch("focuswindow address:" + c)
+
+	if err := bud.MoveWindow(2, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the source shows its next window and the moved one takes over
+	// the target, hiding its old master
+	checkWindows(t, h, []string{b}, []string{a})
+	if got := wsWindows(h, "2"); !reflect.DeepEqual(got, []string{c}) {
+		t.Errorf("workspace 2 windows = %v, want %v", got, []string{c})
+	}
+	if got := wsWindows(h, "special:hidden-2"); !sameSet(got, []string{e, f}) {
+		t.Errorf("workspace 2 hidden windows = %v, want %v", got, []string{e, f})
+	}
+
+	// the old master is next in the target's stack
+	h.Dispatch("workspace 2")
+	if err := bud.FocusNext(); err != nil {
+		t.Fatal(err)
+	}
+	if got := wsWindows(h, "2"); !reflect.DeepEqual(got, []string{f}) {
+		t.Errorf("workspace 2 windows after focus next = %v, want %v", got, []string{f})
+	}
+}
@@ -0,0 +1,388 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/psanford/hypr-buddy/client"
+	"github.com/psanford/hypr-buddy/hyprctl"
+	"github.com/psanford/logmiddleware"
+)
+
+// handleSaveSession returns the current window arrangement as a
+// client.Session.
+func (s *server) handleSaveSession(w http.ResponseWriter, r *http.Request) {
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	sort.Sort(WindowSort(allWindows))
+
+	var sess client.Session
+	for _, win := range allWindows {
+		sw := client.SessionWindow{
+			Address:       win.Address,
+			Class:         win.Class,
+			Title:         win.Title,
+			WorkspaceID:   win.Workspace.ID,
+			WorkspaceName: win.Workspace.Name,
+			Floating:      win.Floating,
+		}
+		copy(sw.At[:], win.At)
+		copy(sw.Size[:], win.Size)
+
+		if ownerID, ok := s.parseHiddenWSName(win.Workspace.Name); ok {
+			owner := s.lookupWSState(ownerID)
+			sw.WorkspaceID = owner.ID
+			sw.WorkspaceName = owner.Name
+			if sw.WorkspaceName == "" {
+				sw.WorkspaceName = fmt.Sprint(owner.ID)
+			}
+			sw.Hidden = true
+		}
+
+		sess.Windows = append(sess.Windows, sw)
+	}
+
+	for _, wsState := range s.sortedSpaces() {
+		sess.Workspaces = append(sess.Workspaces, client.SessionWorkspace{
+			ID:          wsState.ID,
+			Name:        wsState.Name,
+			Layout:      wsState.Layout.String(),
+			WindowOrder: wsState.WindowOrder,
+		})
+	}
+
+	json.NewEncoder(w).Encode(sess)
+}
+
+// handleRestoreSession moves running windows back to where they were in
+// the posted client.Session and re-applies each workspace's layout.
+// Saved windows with no match are started if there is a command for
+// their class in the config.
+func (s *server) handleRestoreSession(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+
+	var sess client.Session
+	err := json.NewDecoder(r.Body).Decode(&sess)
+	if err != nil {
+		lgr.Error("decode session err", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request invalid session: %s", err)
+		return
+	}
+
+	savedSpaces := make(map[int64]client.SessionWorkspace)
+	modes := make(map[int64]LayoutMode)
+	for _, sws := range sess.Workspaces {
+		l, ok := s.layoutByName(sws.Layout)
+		if !ok {
+			lgr.Error("unknown layout", "name", sws.Layout)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Bad request unknown layout %q for workspace %d", sws.Layout, sws.ID)
+			return
+		}
+		savedSpaces[sws.ID] = sws
+		modes[sws.ID] = l.Mode()
+	}
+
+	s.pushSnapshot()
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	// start the session's workspaces from plain tiled so every window is
+	// in view and the layouts can be entered fresh below
+	for _, wsState := range s.sortedSpaces() {
+		for _, sws := range sess.Workspaces {
+			if sws.ID == wsState.ID || (sws.Name != "" && sws.Name == wsState.Name) {
+				s.setLayout(c, wsState, LayoutPrimaryWithStack)
+				break
+			}
+		}
+	}
+
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	matched := matchSessionWindows(sess.Windows, allWindows)
+
+	// grid windows are floated by the grid itself, so they are restored
+	// tiled and the grid re-applied
+	floating := func(sw client.SessionWindow) bool {
+		return sw.Floating && modes[sw.WorkspaceID] != LayoutGrid
+	}
+
+	var result client.RestoreResult
+
+	rs := &sessionRestore{
+		modes:    modes,
+		order:    make(map[int64][]string),
+		matched:  make(map[string]string),
+		deadline: time.Now().Add(sessionLaunchTimeout),
+	}
+	for savedAddr, win := range matched {
+		rs.matched[savedAddr] = win.Address
+	}
+
+	batch := c.Batch()
+	for _, sw := range sess.Windows {
+		win, ok := matched[sw.Address]
+		if !ok {
+			continue
+		}
+		result.Matched++
+
+		if win.Workspace.Name != sw.WorkspaceName {
+			batch.Dispatchf("movetoworkspacesilent %s,address:%s", sessionWSSelector(sw), win.Address)
+		}
+
+		if floating(sw) != win.Floating {
+			if floating(sw) {
+				batch.Dispatchf("setfloating address:%s", win.Address)
+			} else {
+				batch.Dispatchf("settiled address:%s", win.Address)
+			}
+		}
+
+		if floating(sw) {
+			batch.Dispatchf("resizewindowpixel exact %d %d,address:%s", sw.Size[0], sw.Size[1], win.Address)
+			batch.Dispatchf("movewindowpixel exact %d %d,address:%s", sw.At[0], sw.At[1], win.Address)
+		}
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("restore session windows err: %s", err)
+	}
+
+	for _, sw := range sess.Windows {
+		if _, ok := matched[sw.Address]; ok {
+			continue
+		}
+
+		cmd, ok := s.cfg.Session.Commands[sw.Class]
+		if !ok {
+			result.Missing = append(result.Missing, sw.Class)
+			continue
+		}
+
+		rules := []string{fmt.Sprintf("workspace %s silent", sessionWSSelector(sw))}
+		if floating(sw) {
+			rules = append(rules,
+				"float",
+				fmt.Sprintf("size %d %d", sw.Size[0], sw.Size[1]),
+				fmt.Sprintf("move %d %d", sw.At[0], sw.At[1]),
+			)
+		}
+
+		log.Printf("restore session: starting %s", cmd)
+		// exec rules can't go in a batch since they contain ';'
+		err := c.DispatchRaw(fmt.Sprintf("exec [%s] %s", strings.Join(rules, "; "), cmd))
+		if err != nil {
+			log.Printf("restore session exec err: %s", err)
+			continue
+		}
+		result.Launched = append(result.Launched, sw.Class)
+		rs.launched = append(rs.launched, launchedWindow{
+			class:     sw.Class,
+			savedAddr: sw.Address,
+			wsID:      sw.WorkspaceID,
+		})
+	}
+
+	// windows are now on the right workspaces; put each workspace's
+	// tiled windows back in order and re-enter its layout
+	var savedIDs []int64
+	for _, sw := range sess.Windows {
+		if isSpecialWS(sw.WorkspaceName) || floating(sw) {
+			continue
+		}
+		if _, seen := rs.order[sw.WorkspaceID]; !seen {
+			savedIDs = append(savedIDs, sw.WorkspaceID)
+		}
+		rs.order[sw.WorkspaceID] = append(rs.order[sw.WorkspaceID], sw.Address)
+	}
+	for id, sws := range savedSpaces {
+		if len(sws.WindowOrder) > 0 && len(rs.order[id]) > 0 {
+			rs.order[id] = sws.WindowOrder
+		}
+	}
+
+	for _, id := range savedIDs {
+		s.restoreSessionWS(c, rs, id)
+	}
+
+	// apps we started open later; handleWindowOpen puts them in place
+	s.sessionRestore = nil
+	if len(rs.launched) > 0 {
+		s.sessionRestore = rs
+	}
+
+	s.saveState()
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// sessionLaunchTimeout is how long after -restore-session we wait for the
+// apps it started to open their windows.
+const sessionLaunchTimeout = time.Minute
+
+// sessionRestore is what we need to finish restoring a session as the
+// apps it started open their windows.
+type sessionRestore struct {
+	// modes and order are each saved workspace's layout and window
+	// order, keyed by saved workspace ID
+	modes map[int64]LayoutMode
+	order map[int64][]string
+	// matched maps saved window addresses to running ones
+	matched map[string]string
+	// launched are the saved windows we started an app for
+	launched []launchedWindow
+	deadline time.Time
+}
+
+type launchedWindow struct {
+	class     string
+	savedAddr string
+	wsID      int64
+}
+
+// restoreSessionWS puts the running windows of saved workspace id in
+// their saved order and enters the workspace's saved layout.
+func (s *server) restoreSessionWS(c *hyprctl.Client, rs *sessionRestore, id int64) {
+	var liveOrder []string
+	for _, addr := range rs.order[id] {
+		if live, ok := rs.matched[addr]; ok {
+			liveOrder = append(liveOrder, live)
+		}
+	}
+	if len(liveOrder) == 0 {
+		return
+	}
+
+	// named workspaces may not have the same ID as when we saved
+	live, ok := s.lookupWindow(c, liveOrder[0])
+	if !ok || isSpecialWS(live.Workspace.Name) {
+		return
+	}
+
+	wsState := s.getWSState(live.Workspace.ID, live.Workspace.Name)
+	s.setLayout(c, wsState, LayoutPrimaryWithStack)
+	s.moveWindowsToOrder(c, &hyprctl.Workspace{ID: live.Workspace.ID, Name: live.Workspace.Name}, liveOrder)
+	s.setLayout(c, wsState, rs.modes[id])
+}
+
+// sessionWindowOpened checks whether win is one -restore-session started,
+// and if so re-applies its workspace's saved order and layout with win in
+// it. It reports whether it did.
+func (s *server) sessionWindowOpened(c *hyprctl.Client, win hyprctl.Window) bool {
+	rs := s.sessionRestore
+	if rs == nil {
+		return false
+	}
+	if time.Now().After(rs.deadline) {
+		s.sessionRestore = nil
+		return false
+	}
+
+	for i, lw := range rs.launched {
+		if lw.class != win.Class && lw.class != win.InitialClass {
+			continue
+		}
+
+		rs.launched = append(rs.launched[:i:i], rs.launched[i+1:]...)
+		if len(rs.launched) == 0 {
+			s.sessionRestore = nil
+		}
+
+		// a layout entered since the app started may have hidden it
+		// already
+		_, hidden := s.parseHiddenWSName(win.Workspace.Name)
+		if win.Floating || (isSpecialWS(win.Workspace.Name) && !hidden) {
+			return false
+		}
+
+		log.Printf("restore session: %s opened as %s", lw.savedAddr, win.Address)
+		rs.matched[lw.savedAddr] = win.Address
+		s.restoreSessionWS(c, rs, lw.wsID)
+		s.saveState()
+		return true
+	}
+	return false
+}
+
+// matchSessionWindows pairs saved windows with running ones, keyed by
+// saved address. A running window with the same class and title is
+// preferred; failing that, the one of the same class whose title shares
+// the longest prefix with the saved title.
+func matchSessionWindows(saved []client.SessionWindow, running []hyprctl.Window) map[string]hyprctl.Window {
+	matched := make(map[string]hyprctl.Window)
+	used := make(map[string]bool)
+
+	sameClass := func(sw client.SessionWindow, win hyprctl.Window) bool {
+		return win.Class == sw.Class || win.InitialClass == sw.Class
+	}
+
+	for _, sw := range saved {
+		for _, win := range running {
+			if !used[win.Address] && sameClass(sw, win) && win.Title == sw.Title {
+				matched[sw.Address] = win
+				used[win.Address] = true
+				break
+			}
+		}
+	}
+
+	for _, sw := range saved {
+		if _, ok := matched[sw.Address]; ok {
+			continue
+		}
+
+		best := -1
+		for i, win := range running {
+			if used[win.Address] || !sameClass(sw, win) {
+				continue
+			}
+			if best < 0 || commonPrefixLen(win.Title, sw.Title) > commonPrefixLen(running[best].Title, sw.Title) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			matched[sw.Address] = running[best]
+			used[running[best].Address] = true
+		}
+	}
+
+	return matched
+}
+
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// sessionWSSelector is how dispatchers refer to a saved window's
+// workspace.
+func sessionWSSelector(sw client.SessionWindow) string {
+	if isSpecialWS(sw.WorkspaceName) {
+		return sw.WorkspaceName
+	}
+	return (&WorkspaceDesiredState{ID: sw.WorkspaceID, Name: sw.WorkspaceName}).selector()
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+// stackedLayout shows only the master window. The rest of WindowOrder is
+// parked on the workspace's hidden workspace, and focus next/prev rotates
+// through them.
+type stackedLayout struct {
+	s *server
+}
+
+func (l *stackedLayout) Mode() LayoutMode {
+	return LayoutSingleWindow
+}
+
+func (l *stackedLayout) Enter(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	sort.Sort(WindowSort(allWindows))
+
+	hiddenName := l.s.hiddenWSName(wsState.ID)
+
+	windowOrder := make([]string, 0, 10)
+
+	wsWindows := make([]hyprctl.Window, 0, 10)
+	for _, w := range allWindows {
+		if w.Workspace.ID != wsState.ID || l.s.noStack[w.Address] {
+			continue
+		}
+
+		windowOrder = append(windowOrder, w.Address)
+		wsWindows = append(wsWindows, w)
+	}
+
+	if len(wsWindows) > 1 {
+		// move all the windows except the master to the shadow workspace
+		batch := c.Batch()
+		for _, w := range wsWindows[1:] {
+			batch.Dispatchf("movetoworkspacesilent %s,address:%s", hiddenName, w.Address)
+		}
+		if _, err := batch.Run(); err != nil {
+			log.Printf("hide windows err: %s", err)
+		}
+	}
+
+	wsState.WindowOrder = windowOrder
+}
+
+func (l *stackedLayout) Exit(c *hyprctl.Client, wsState *WorkspaceDesiredState) {
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	hiddenName := l.s.hiddenWSName(wsState.ID)
+
+	batch := c.Batch()
+	for _, w := range allWindows {
+		if w.Workspace.Name != hiddenName {
+			continue
+		}
+
+		batch.Dispatchf("movetoworkspacesilent %s,address:%s", wsState.selector(), w.Address)
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("unhide windows err: %s", err)
+	}
+	l.s.moveWindowsToOrder(c, &hyprctl.Workspace{ID: wsState.ID, Name: wsState.Name}, wsState.WindowOrder)
+}
+
+func (l *stackedLayout) WindowOpened(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string) bool {
+	l.s.adoptAsMaster(c, wsState, addr)
+	return true
+}
+
+func (l *stackedLayout) WindowClosed(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string, idx int) {
+	if idx == 0 && len(wsState.WindowOrder) > 0 {
+		c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %s,address:%s", wsState.selector(), wsState.WindowOrder[0]))
+	}
+}
+
+func (l *stackedLayout) Focus(c *hyprctl.Client, wsState *WorkspaceDesiredState, n int) {
+	if len(wsState.WindowOrder) < 2 {
+		log.Printf("window order < 2, nothing to toggle")
+		return
+	}
+
+	hiddenName := l.s.hiddenWSName(wsState.ID)
+
+	oldMaster := wsState.WindowOrder[0]
+
+	var newMaster string
+	newOrder := make([]string, len(wsState.WindowOrder))
+	if n < 0 { // cycle prev
+		newMaster = wsState.WindowOrder[len(wsState.WindowOrder)-1]
+
+		// before:
+		// [a, b, c, d, e]
+		// after:
+		// [e, a, b, c, d]
+
+		newOrder[0] = newMaster
+		newOrder[1] = oldMaster
+		if len(wsState.WindowOrder) > 2 {
+			copy(newOrder[2:], wsState.WindowOrder[1:len(wsState.WindowOrder)-1])
+		}
+
+	} else { // cycle next
+		newMaster = wsState.WindowOrder[1]
+
+		// before:
+		// [a, b, c, d, e]
+		// after:
+		// [b, c, d, e, a]
+
+		copy(newOrder, wsState.WindowOrder[1:])
+		newOrder[len(newOrder)-1] = oldMaster
+	}
+
+	wsState.WindowOrder = newOrder
+
+	batch := c.Batch()
+	batch.Dispatchf("movetoworkspacesilent %s,address:%s", wsState.selector(), newMaster)
+	batch.Dispatchf("movetoworkspacesilent %s,address:%s", hiddenName, oldMaster)
+	if _, err := batch.Run(); err != nil {
+		log.Printf("swap master err: %s", err)
+	}
+
+	l.s.saveState()
+}
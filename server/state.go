@@ -0,0 +1,279 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/psanford/hypr-buddy/config"
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+type persistedState struct {
+	Spaces []*WorkspaceDesiredState `json:"spaces"`
+
+	ActiveProfile   string            `json:"active_profile,omitempty"`
+	ProfileSnapshot map[string]string `json:"profile_snapshot,omitempty"`
+
+	ScratchWindows map[string]string `json:"scratch_windows,omitempty"`
+}
+
+// saveState writes the desired workspace state to disk so a restarted
+// daemon can pick up where it left off.
+func (s *server) saveState() {
+	st := persistedState{
+		Spaces:          s.sortedSpaces(),
+		ActiveProfile:   s.activeProfile,
+		ProfileSnapshot: s.profileSnapshot,
+		ScratchWindows:  s.scratchWindows,
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		log.Printf("marshal state err: %s", err)
+		return
+	}
+
+	path := config.StatePath()
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, b, 0600)
+	if err != nil {
+		log.Printf("write state err: %s", err)
+		return
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		log.Printf("rename state err: %s", err)
+	}
+}
+
+func (s *server) loadState() error {
+	b, err := os.ReadFile(config.StatePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var st persistedState
+	err = json.Unmarshal(b, &st)
+	if err != nil {
+		return err
+	}
+
+	for _, wsState := range st.Spaces {
+		if wsState == nil || wsState.ID == 0 {
+			continue
+		}
+		s.spaces[wsState.ID] = wsState
+	}
+
+	s.activeProfile = st.ActiveProfile
+	s.profileSnapshot = st.ProfileSnapshot
+	if st.ScratchWindows != nil {
+		s.scratchWindows = st.ScratchWindows
+	}
+
+	return nil
+}
+
+// reconcileState makes the live windows match the desired state. Addresses
+// that no longer exist are dropped from WindowOrder, stacked workspaces get
+// their master shown and the rest hidden, and any window left in a hidden
+// workspace of an unstacked workspace is brought back.
+func (s *server) reconcileState() {
+	s.reconcileWorkspaces(nil)
+}
+
+// reconcileWorkspaces is reconcileState for just the workspaces in ids, or
+// for every workspace if ids is nil.
+func (s *server) reconcileWorkspaces(ids []int64) {
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	sort.Sort(WindowSort(allWindows))
+
+	windowsByID := make(map[string]hyprctl.Window)
+	for _, w := range allWindows {
+		windowsByID[w.Address] = w
+	}
+
+	workspaces, err := c.Workspaces()
+	if err != nil {
+		panic(err)
+	}
+
+	var spaces []*WorkspaceDesiredState
+	if ids == nil {
+		// make sure every live workspace, and every workspace we
+		// previously hid windows for, has state
+		for _, ws := range workspaces {
+			if !isSpecialWS(ws.Name) {
+				s.getWSState(ws.ID, ws.Name)
+			}
+		}
+		for _, w := range allWindows {
+			if id, ok := s.parseHiddenWSName(w.Workspace.Name); ok {
+				s.getWSState(id, "")
+			}
+		}
+		spaces = s.sortedSpaces()
+	} else {
+		names := make(map[int64]string)
+		for _, ws := range workspaces {
+			names[ws.ID] = ws.Name
+		}
+		for _, id := range ids {
+			spaces = append(spaces, s.getWSState(id, names[id]))
+		}
+	}
+
+	var reorder, regrid, recenter []*WorkspaceDesiredState
+
+	batch := c.Batch()
+	for _, wsState := range spaces {
+		wsID := wsState.ID
+		hiddenName := s.hiddenWSName(wsID)
+
+		var visible, hidden []string
+		for _, w := range allWindows {
+			if w.Workspace.ID == wsID && !w.Floating && !s.noStack[w.Address] {
+				visible = append(visible, w.Address)
+			} else if w.Workspace.Name == hiddenName {
+				hidden = append(hidden, w.Address)
+			}
+		}
+
+		var order []string
+		seen := make(map[string]bool)
+		for _, addr := range wsState.WindowOrder {
+			if _, ok := windowsByID[addr]; ok {
+				order = append(order, addr)
+				seen[addr] = true
+			}
+		}
+
+		if wsState.Layout == LayoutGrid {
+			// only re-arrange if something changed, so we don't undo
+			// any manual adjustments every reconcileInterval
+			changed := len(order) != len(wsState.WindowOrder)
+			var grid []string
+			for _, addr := range order {
+				if windowsByID[addr].Workspace.ID == wsID {
+					grid = append(grid, addr)
+					changed = changed || !windowsByID[addr].Floating
+				}
+			}
+			for _, addr := range visible {
+				if !seen[addr] {
+					grid = append(grid, addr)
+				}
+			}
+			for _, addr := range hidden {
+				batch.Dispatchf("movetoworkspacesilent %s,address:%s", wsState.selector(), addr)
+				grid = append(grid, addr)
+			}
+			changed = changed || len(grid) != len(order)
+
+			wsState.WindowOrder = grid
+			if changed {
+				regrid = append(regrid, wsState)
+			}
+			continue
+		}
+
+		if wsState.Layout == LayoutCentered {
+			var centered []string
+			for _, addr := range order {
+				w := windowsByID[addr]
+				if w.Workspace.ID == wsID && !w.Floating {
+					centered = append(centered, addr)
+				}
+			}
+			changed := len(centered) != len(wsState.WindowOrder)
+			for _, addr := range visible {
+				if !seen[addr] {
+					centered = append([]string{addr}, centered...)
+					changed = true
+				}
+			}
+			for _, addr := range hidden {
+				batch.Dispatchf("movetoworkspacesilent %s,address:%s", wsState.selector(), addr)
+				centered = append(centered, addr)
+				changed = true
+			}
+
+			wsState.WindowOrder = centered
+			if changed {
+				recenter = append(recenter, wsState)
+			}
+			continue
+		}
+
+		if wsState.Layout != LayoutSingleWindow {
+			for _, addr := range hidden {
+				batch.Dispatchf("movetoworkspacesilent %s,address:%s", wsState.selector(), addr)
+			}
+			wsState.WindowOrder = order
+			if len(hidden) > 0 && len(order) > 0 {
+				reorder = append(reorder, wsState)
+			}
+			continue
+		}
+
+		// windows opened while we weren't running go in front if they are
+		// on screen, and at the back if something else hid them
+		var newVisible []string
+		for _, addr := range visible {
+			if !seen[addr] {
+				newVisible = append(newVisible, addr)
+			}
+		}
+		order = append(newVisible, order...)
+		for _, addr := range hidden {
+			if !seen[addr] {
+				order = append(order, addr)
+			}
+		}
+
+		if len(order) == 0 {
+			wsState.Layout = LayoutPrimaryWithStack
+			wsState.WindowOrder = nil
+			continue
+		}
+
+		wsState.WindowOrder = order
+		for i, addr := range order {
+			w := windowsByID[addr]
+			if i == 0 && w.Workspace.ID != wsID {
+				batch.Dispatchf("movetoworkspacesilent %s,address:%s", wsState.selector(), addr)
+			} else if i > 0 && w.Workspace.Name != hiddenName {
+				batch.Dispatchf("movetoworkspacesilent %s,address:%s", hiddenName, addr)
+			}
+		}
+	}
+
+	if _, err := batch.Run(); err != nil {
+		log.Printf("reconcile err: %s", err)
+	}
+
+	for _, wsState := range reorder {
+		s.moveWindowsToOrder(c, &hyprctl.Workspace{ID: wsState.ID, Name: wsState.Name}, wsState.WindowOrder)
+	}
+	for _, wsState := range regrid {
+		s.arrangeGrid(c, wsState)
+	}
+	for _, wsState := range recenter {
+		s.arrangeCentered(c, wsState)
+	}
+
+	s.saveState()
+}
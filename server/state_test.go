@@ -0,0 +1,150 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestReconcileState(t *testing.T) {
+	type wsWant struct {
+		layout  LayoutMode
+		order   []string
+		visible []string
+		hidden  []string
+	}
+
+	// windows a, b and c start out tiled c, b, a on workspace 1. Window
+	// orders are given by class, and "dead" is a window that has closed.
+	tests := []struct {
+		name string
+		// hide parks windows on special:hidden-N behind the daemon's back
+		hide   map[string]int64
+		spaces []WorkspaceDesiredState
+		want   map[int64]wsWant
+	}{
+		{
+			name: "dead address dropped from tiled workspace",
+			spaces: []WorkspaceDesiredState{
+				{ID: 1, Layout: LayoutPrimaryWithStack, WindowOrder: []string{"c", "dead", "b"}},
+			},
+			want: map[int64]wsWant{
+				1: {layout: LayoutPrimaryWithStack, order: []string{"c", "b"}, visible: []string{"c", "b", "a"}},
+			},
+		},
+		{
+			name: "stacked workspace restored without dead address",
+			spaces: []WorkspaceDesiredState{
+				{ID: 1, Layout: LayoutSingleWindow, WindowOrder: []string{"b", "dead", "a", "c"}},
+			},
+			want: map[int64]wsWant{
+				1: {layout: LayoutSingleWindow, order: []string{"b", "a", "c"}, visible: []string{"b"}, hidden: []string{"a", "c"}},
+			},
+		},
+		{
+			name: "stacked workspace with only dead windows",
+			spaces: []WorkspaceDesiredState{
+				{ID: 3, Layout: LayoutSingleWindow, WindowOrder: []string{"dead"}},
+			},
+			want: map[int64]wsWant{
+				1: {layout: LayoutPrimaryWithStack, visible: []string{"c", "b", "a"}},
+				3: {layout: LayoutPrimaryWithStack},
+			},
+		},
+		{
+			name: "stranded windows brought back to tiled workspace in order",
+			hide: map[string]int64{"a": 1, "b": 1},
+			spaces: []WorkspaceDesiredState{
+				{ID: 1, Layout: LayoutPrimaryWithStack, WindowOrder: []string{"a", "c", "b"}},
+			},
+			want: map[int64]wsWant{
+				1: {layout: LayoutPrimaryWithStack, order: []string{"a", "c", "b"}, visible: []string{"a", "c", "b"}},
+			},
+		},
+		{
+			name: "stranded window re-homed to workspace with no state",
+			hide: map[string]int64{"a": 2},
+			want: map[int64]wsWant{
+				1: {layout: LayoutPrimaryWithStack, visible: []string{"c", "b"}},
+				2: {layout: LayoutPrimaryWithStack, visible: []string{"a"}},
+			},
+		},
+		{
+			name: "stacked workspace adopts unknown windows",
+			hide: map[string]int64{"a": 1},
+			spaces: []WorkspaceDesiredState{
+				{ID: 1, Layout: LayoutSingleWindow, WindowOrder: []string{"c"}},
+			},
+			want: map[int64]wsWant{
+				1: {layout: LayoutSingleWindow, order: []string{"b", "c", "a"}, visible: []string{"b"}, hidden: []string{"a", "c"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, a, b, c := newHypr(t)
+
+			addrs := map[string]string{"a": a, "b": b, "c": c, "dead": "0xdead"}
+			toAddrs := func(names []string) []string {
+				var out []string
+				for _, name := range names {
+					out = append(out, addrs[name])
+				}
+				return out
+			}
+
+			for name, id := range tt.hide {
+				h.Dispatch(fmt.Sprintf("movetoworkspacesilent special:hidden-%d,address:%s", id, addrs[name]))
+			}
+
+			s := New()
+			for _, wsState := range tt.spaces {
+				wsState := wsState
+				wsState.WindowOrder = toAddrs(wsState.WindowOrder)
+				s.spaces[wsState.ID] = &wsState
+			}
+
+			s.reconcileState()
+
+			for id, want := range tt.want {
+				wsState := s.spaces[id]
+				if wsState == nil {
+					t.Errorf("workspace %d has no state", id)
+					continue
+				}
+				if wsState.Layout != want.layout {
+					t.Errorf("workspace %d layout = %s, want %s", id, wsState.Layout, want.layout)
+				}
+				if wantOrder := toAddrs(want.order); !reflect.DeepEqual(wsState.WindowOrder, wantOrder) {
+					t.Errorf("workspace %d order = %v, want %v", id, wsState.WindowOrder, wantOrder)
+				}
+
+				visible := wsWindows(h, fmt.Sprint(id))
+				if wantVisible := append([]string{}, toAddrs(want.visible)...); !reflect.DeepEqual(visible, wantVisible) {
+					t.Errorf("workspace %d windows = %v, want %v", id, visible, wantVisible)
+				}
+				hidden := wsWindows(h, fmt.Sprintf("special:hidden-%d", id))
+				if !sameSet(hidden, toAddrs(want.hidden)) {
+					t.Errorf("workspace %d hidden windows = %v, want %v", id, hidden, toAddrs(want.hidden))
+				}
+			}
+		})
+	}
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool)
+	for _, x := range a {
+		set[x] = true
+	}
+	for _, x := range b {
+		if !set[x] {
+			return false
+		}
+	}
+	return true
+}
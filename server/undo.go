@@ -0,0 +1,234 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+// undoHistorySize is how many snapshots -undo can go back through.
+const undoHistorySize = 20
+
+// snapshot is everything a mutating command can change: where each window
+// is, and our desired state for each workspace.
+type snapshot struct {
+	windows      []windowSnapshot
+	spaces       []WorkspaceDesiredState
+	activeWindow string
+}
+
+type windowSnapshot struct {
+	Address       string
+	WorkspaceID   int64
+	WorkspaceName string
+	Floating      bool
+	At            [2]int64
+	Size          [2]int64
+}
+
+// pushSnapshot records the current layout on the undo history. Commands
+// call it once they have validated their parameters, just before they
+// change anything.
+func (s *server) pushSnapshot() {
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	snap, err := s.takeSnapshot(c)
+	if err != nil {
+		log.Printf("snapshot err: %s", err)
+		return
+	}
+
+	if n := len(s.undoHistory); n > 0 && reflect.DeepEqual(s.undoHistory[n-1], snap) {
+		return
+	}
+
+	s.undoHistory = append(s.undoHistory, snap)
+	if len(s.undoHistory) > undoHistorySize {
+		s.undoHistory = s.undoHistory[len(s.undoHistory)-undoHistorySize:]
+	}
+}
+
+func (s *server) takeSnapshot(c *hyprctl.Client) (*snapshot, error) {
+	allWindows, err := c.Windows()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(WindowSort(allWindows))
+
+	snap := &snapshot{
+		activeWindow: s.activeWindow,
+	}
+
+	for _, w := range allWindows {
+		ws := windowSnapshot{
+			Address:       w.Address,
+			WorkspaceID:   w.Workspace.ID,
+			WorkspaceName: w.Workspace.Name,
+			Floating:      w.Floating,
+		}
+		copy(ws.At[:], w.At)
+		copy(ws.Size[:], w.Size)
+		snap.windows = append(snap.windows, ws)
+	}
+
+	for _, wsState := range s.sortedSpaces() {
+		cp := *wsState
+		cp.WindowOrder = append([]string(nil), wsState.WindowOrder...)
+		snap.spaces = append(snap.spaces, cp)
+	}
+
+	return snap, nil
+}
+
+func (s *server) handleUndo(w http.ResponseWriter, r *http.Request) {
+	if len(s.undoHistory) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request nothing to undo")
+		return
+	}
+
+	snap := s.undoHistory[len(s.undoHistory)-1]
+	s.undoHistory = s.undoHistory[:len(s.undoHistory)-1]
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	s.restoreSnapshot(c, snap)
+}
+
+// restoreSnapshot puts windows back where they were in snap. Windows
+// that have closed since are ignored. Ones that have opened since go to
+// the back of their workspace's window order, so on a stacked workspace
+// they end up hidden behind the restored master.
+func (s *server) restoreSnapshot(c *hyprctl.Client, snap *snapshot) {
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	sort.Sort(WindowSort(allWindows))
+
+	windowsByID := make(map[string]hyprctl.Window)
+	for _, w := range allWindows {
+		windowsByID[w.Address] = w
+	}
+
+	// the master layout orientation isn't part of the window positions,
+	// so undo any centering by hand
+	snapLayouts := make(map[int64]LayoutMode)
+	for _, wsState := range snap.spaces {
+		snapLayouts[wsState.ID] = wsState.Layout
+	}
+	for _, wsState := range s.sortedSpaces() {
+		if wsState.Layout == LayoutCentered && snapLayouts[wsState.ID] != LayoutCentered {
+			s.layout(LayoutCentered).Exit(c, wsState)
+		}
+	}
+
+	// restore our state first so the events caused by the moves below
+	// are no-ops
+	s.spaces = make(map[int64]*WorkspaceDesiredState)
+	for _, wsState := range snap.spaces {
+		cp := wsState
+		cp.WindowOrder = append([]string(nil), wsState.WindowOrder...)
+		s.spaces[cp.ID] = &cp
+	}
+
+	inSnap := make(map[string]bool)
+	for _, ws := range snap.windows {
+		inSnap[ws.Address] = true
+	}
+	for _, w := range allWindows {
+		if inSnap[w.Address] || s.noStack[w.Address] {
+			continue
+		}
+		id := w.Workspace.ID
+		if owner, ok := s.parseHiddenWSName(w.Workspace.Name); ok {
+			id = owner
+		} else if isSpecialWS(w.Workspace.Name) {
+			continue
+		}
+		wsState := s.spaces[id]
+		if wsState == nil || wsState.Layout == LayoutPrimaryWithStack {
+			continue
+		}
+		// grid windows are floating because of us
+		if w.Floating && wsState.Layout != LayoutGrid {
+			continue
+		}
+		wsState.WindowOrder = append(wsState.WindowOrder, w.Address)
+	}
+
+	batch := c.Batch()
+	for _, ws := range snap.windows {
+		cur, ok := windowsByID[ws.Address]
+		if !ok {
+			continue
+		}
+
+		if cur.Workspace.ID != ws.WorkspaceID {
+			target := ws.WorkspaceName
+			if !isSpecialWS(target) {
+				target = (&WorkspaceDesiredState{ID: ws.WorkspaceID, Name: ws.WorkspaceName}).selector()
+			}
+			batch.Dispatchf("movetoworkspacesilent %s,address:%s", target, ws.Address)
+		}
+
+		if cur.Floating != ws.Floating {
+			if ws.Floating {
+				batch.Dispatchf("setfloating address:%s", ws.Address)
+			} else {
+				batch.Dispatchf("settiled address:%s", ws.Address)
+			}
+		}
+
+		if ws.Floating {
+			batch.Dispatchf("resizewindowpixel exact %d %d,address:%s", ws.Size[0], ws.Size[1], ws.Address)
+			batch.Dispatchf("movewindowpixel exact %d %d,address:%s", ws.At[0], ws.At[1], ws.Address)
+		}
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("restore windows err: %s", err)
+	}
+
+	// then put the tiled windows on each workspace back in order
+	tiledOrder := make(map[int64][]string)
+	for _, ws := range snap.windows {
+		if _, ok := windowsByID[ws.Address]; ok && !ws.Floating && !isSpecialWS(ws.WorkspaceName) {
+			tiledOrder[ws.WorkspaceID] = append(tiledOrder[ws.WorkspaceID], ws.Address)
+		}
+	}
+	for _, wsState := range s.sortedSpaces() {
+		order := tiledOrder[wsState.ID]
+		if len(order) == 0 {
+			continue
+		}
+
+		if wsState.Layout == LayoutCentered {
+			s.arrangeCentered(c, wsState)
+		} else {
+			s.moveWindowsToOrder(c, &hyprctl.Workspace{ID: wsState.ID, Name: wsState.Name}, order)
+		}
+		if wsState.Layout == LayoutPrimaryWithStack {
+			s.applyMaster(c, wsState)
+		}
+	}
+
+	if _, ok := windowsByID[snap.activeWindow]; ok {
+		c.DispatchRaw(fmt.Sprintf("focuswindow address:%s", snap.activeWindow))
+	}
+
+	// hide or show the windows we added to the restored orders, and pick
+	// up workspaces created since the snapshot
+	s.reconcileState()
+}
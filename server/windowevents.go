@@ -0,0 +1,221 @@
+package server
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+// handleWindowMove keeps WindowOrder in sync when a window changes
+// workspace. Our own hide/unhide dispatches also arrive here, but since
+// they are processed after the command that issued them has updated
+// WindowOrder they are no-ops.
+func (s *server) handleWindowMove(evt hyprctl.MoveWindowV2Event) {
+	log.Printf("evt window move %s -> %s", evt.Address, evt.WorkspaceName)
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	// the window may have been one of its old workspace's masters
+	defer s.clampMasters(c)
+
+	prev, _ := s.findInOrder(evt.Address)
+
+	if ownerID, ok := s.parseHiddenWSName(evt.WorkspaceName); ok {
+		owner := s.getWSState(ownerID, "")
+		if prev != nil && prev != owner {
+			s.dropFromOrder(c, prev, evt.Address)
+		}
+
+		if owner.Layout != LayoutSingleWindow {
+			// nothing should be hidden on an unstacked workspace
+			c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %s,address:%s", owner.selector(), evt.Address))
+		} else if prev != owner {
+			owner.WindowOrder = append(owner.WindowOrder, evt.Address)
+		}
+
+		s.saveState()
+		return
+	}
+
+	if isSpecialWS(evt.WorkspaceName) {
+		// moved out of our way, e.g. to a scratchpad
+		if prev != nil {
+			s.dropFromOrder(c, prev, evt.Address)
+			s.saveState()
+		}
+		return
+	}
+
+	target := s.getWSState(evt.WorkspaceID, evt.WorkspaceName)
+	if prev == target {
+		return
+	}
+
+	if prev != nil {
+		s.dropFromOrder(c, prev, evt.Address)
+
+		if prev.Layout == LayoutGrid && target.Layout != LayoutGrid {
+			// we floated it for the grid; the resulting floating
+			// change event adds it to target's stack if needed
+			c.DispatchRaw(fmt.Sprintf("settiled address:%s", evt.Address))
+			s.saveState()
+			return
+		}
+	}
+
+	// windows coming from another grid are floating because of us
+	fromGrid := prev != nil && prev.Layout == LayoutGrid
+	if (fromGrid || !s.isFloating(c, evt.Address)) && !s.noStack[evt.Address] {
+		s.layout(target.Layout).WindowOpened(c, target, evt.Address)
+	}
+
+	s.saveState()
+}
+
+// handleFloatingChange removes windows from the stack when they start
+// floating and adds them back as master when they are tiled again.
+func (s *server) handleFloatingChange(evt hyprctl.ChangeFloatingModeEvent) {
+	log.Printf("evt window floating=%t %s", evt.Floating, evt.Address)
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	prev, _ := s.findInOrder(evt.Address)
+
+	if prev != nil && prev.Layout == LayoutGrid {
+		// grid windows are floated by arrangeGrid; one that gets tiled
+		// again leaves the grid
+		if !evt.Floating {
+			s.dropFromOrder(c, prev, evt.Address)
+			s.saveState()
+		}
+		return
+	}
+
+	if evt.Floating {
+		if prev != nil {
+			s.dropFromOrder(c, prev, evt.Address)
+			s.saveState()
+		}
+		return
+	}
+
+	if prev != nil || s.noStack[evt.Address] {
+		return
+	}
+
+	win, ok := s.lookupWindow(c, evt.Address)
+	if !ok || isSpecialWS(win.Workspace.Name) {
+		return
+	}
+
+	wsState := s.getWSState(win.Workspace.ID, win.Workspace.Name)
+	if s.layout(wsState.Layout).WindowOpened(c, wsState, evt.Address) {
+		s.saveState()
+	}
+}
+
+// handleFullscreen is called on fullscreen changes. The event does not say
+// which window changed, but fullscreen always applies to the active window,
+// so we re-check the active workspace against Windows().
+func (s *server) handleFullscreen(evt hyprctl.FullscreenEvent) {
+	log.Printf("evt fullscreen=%t", evt.Fullscreen)
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	ws, err := c.ActiveWorkspace()
+	if err != nil {
+		panic(err)
+	}
+	if isSpecialWS(ws.Name) {
+		return
+	}
+
+	s.reconcileWorkspaces([]int64{ws.ID})
+}
+
+// periodicReconcile fixes any drift we missed events for. Errors are
+// logged rather than crashing the daemon.
+func (s *server) periodicReconcile() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("periodic reconcile err: %s", r)
+		}
+	}()
+	s.reconcileState()
+}
+
+// findInOrder returns the workspace whose WindowOrder includes addr.
+func (s *server) findInOrder(addr string) (*WorkspaceDesiredState, int) {
+	for _, wsState := range s.spaces {
+		for i, other := range wsState.WindowOrder {
+			if other == addr {
+				return wsState, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+// dropFromOrder removes addr from wsState's WindowOrder and lets the
+// workspace's layout react, e.g. by showing the next window if addr was
+// the master of a stacked workspace.
+func (s *server) dropFromOrder(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string) {
+	idx := -1
+	for i, other := range wsState.WindowOrder {
+		if other == addr {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return
+	}
+
+	order := make([]string, 0, len(wsState.WindowOrder)-1)
+	order = append(order, wsState.WindowOrder[:idx]...)
+	order = append(order, wsState.WindowOrder[idx+1:]...)
+	wsState.WindowOrder = order
+
+	s.layout(wsState.Layout).WindowClosed(c, wsState, addr, idx)
+}
+
+// adoptAsMaster makes addr the master of a stacked workspace, hiding the
+// current master.
+func (s *server) adoptAsMaster(c *hyprctl.Client, wsState *WorkspaceDesiredState, addr string) {
+	if len(wsState.WindowOrder) > 0 {
+		oldMaster := wsState.WindowOrder[0]
+		hiddenName := s.hiddenWSName(wsState.ID)
+		c.DispatchRaw(fmt.Sprintf("movetoworkspacesilent %s,address:%s", hiddenName, oldMaster))
+	}
+
+	wsState.WindowOrder = append([]string{addr}, wsState.WindowOrder...)
+}
+
+func (s *server) lookupWindow(c *hyprctl.Client, addr string) (hyprctl.Window, bool) {
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, w := range allWindows {
+		if w.Address == addr {
+			return w, true
+		}
+	}
+	return hyprctl.Window{}, false
+}
+
+func (s *server) isFloating(c *hyprctl.Client, addr string) bool {
+	w, ok := s.lookupWindow(c, addr)
+	return ok && w.Floating
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/psanford/hypr-buddy/client"
+	"github.com/psanford/hypr-buddy/hyprctl"
+	"github.com/psanford/logmiddleware"
+)
+
+// handleListWindows returns every window as a client.WindowInfo. Windows
+// hidden in a stack are listed under the workspace they belong to, in
+// stack order after the master.
+func (s *server) handleListWindows(w http.ResponseWriter, r *http.Request) {
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	allWindows, err := c.Windows()
+	if err != nil {
+		panic(err)
+	}
+
+	sort.Sort(WindowSort(allWindows))
+
+	infos := make([]client.WindowInfo, 0, len(allWindows))
+	for _, win := range allWindows {
+		info := client.WindowInfo{
+			Address:       win.Address,
+			Class:         win.Class,
+			Title:         win.Title,
+			WorkspaceID:   win.Workspace.ID,
+			WorkspaceName: win.Workspace.Name,
+			Floating:      win.Floating,
+		}
+
+		if ownerID, ok := s.parseHiddenWSName(win.Workspace.Name); ok {
+			owner := s.lookupWSState(ownerID)
+			info.WorkspaceID = owner.ID
+			info.WorkspaceName = owner.Name
+			if info.WorkspaceName == "" {
+				info.WorkspaceName = fmt.Sprint(owner.ID)
+			}
+			info.Hidden = true
+		}
+
+		infos = append(infos, info)
+	}
+
+	rank := func(info client.WindowInfo) int {
+		if wsState := s.spaces[info.WorkspaceID]; wsState != nil {
+			for i, addr := range wsState.WindowOrder {
+				if addr == info.Address {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		aSpecial, bSpecial := isSpecialWS(a.WorkspaceName), isSpecialWS(b.WorkspaceName)
+		if aSpecial != bSpecial {
+			return bSpecial
+		}
+		if a.WorkspaceID != b.WorkspaceID {
+			return a.WorkspaceID < b.WorkspaceID
+		}
+		if a.Hidden != b.Hidden {
+			return b.Hidden
+		}
+		if a.Hidden {
+			return rank(a) < rank(b)
+		}
+		return false
+	})
+
+	json.NewEncoder(w).Encode(infos)
+}
+
+// handleFocusWindow focuses a window by address, bringing it out of its
+// stack if it is hidden.
+func (s *server) handleFocusWindow(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+	addr := r.FormValue("address")
+	if !strings.HasPrefix(addr, "0x") {
+		addr = "0x" + addr
+	}
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	if _, ok := s.lookupWindow(c, addr); !ok {
+		lgr.Error("unknown window", "address", addr)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request no window with address %q", addr)
+		return
+	}
+
+	s.pushSnapshot()
+	s.focusWindow(c, addr)
+}
+
+// handleMoveWindow moves the active window to another workspace. Both
+// workspaces' window order is updated here rather than waiting for the
+// move event, so a stacked source shows its next window and a stacked
+// target gets the moved window as master straight away.
+func (s *server) handleMoveWindow(w http.ResponseWriter, r *http.Request) {
+	lgr := logmiddleware.LgrFromContext(r.Context())
+	wsStr := r.FormValue("workspace")
+	wsID, err := strconv.ParseInt(wsStr, 10, 64)
+	if err != nil || wsID < 1 {
+		lgr.Error("invalid workspace", "workspace", wsStr)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Bad request invalid workspace parameter")
+		return
+	}
+	follow := r.FormValue("follow") != ""
+
+	s.pushSnapshot()
+
+	c, err := hyprctl.New()
+	if err != nil {
+		panic(err)
+	}
+
+	win, err := c.ActiveWindow()
+	if err != nil {
+		panic(err)
+	}
+	if win.Address == "" {
+		log.Printf("no active window to move")
+		return
+	}
+	addr := win.Address
+
+	target := s.getWSState(wsID, "")
+
+	prev, _ := s.findInOrder(addr)
+	if prev == target {
+		return
+	}
+
+	fromGrid := prev != nil && prev.Layout == LayoutGrid
+	if prev != nil {
+		s.dropFromOrder(c, prev, addr)
+	}
+
+	batch := c.Batch()
+	if fromGrid && target.Layout != LayoutGrid {
+		// we floated it for the grid
+		batch.Dispatchf("settiled address:%s", addr)
+	}
+	if follow {
+		batch.Dispatchf("movetoworkspace %s,address:%s", target.selector(), addr)
+	} else {
+		batch.Dispatchf("movetoworkspacesilent %s,address:%s", target.selector(), addr)
+	}
+	if _, err := batch.Run(); err != nil {
+		log.Printf("move window err: %s", err)
+	}
+
+	if (fromGrid || !win.Floating) && !s.noStack[addr] {
+		s.layout(target.Layout).WindowOpened(c, target, addr)
+	}
+
+	s.saveState()
+}
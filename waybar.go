@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/psanford/hypr-buddy/client"
+	"github.com/psanford/hypr-buddy/hyprctl"
+)
+
+// waybarOutput is one line of a Waybar custom module with
+// "return-type": "json".
+type waybarOutput struct {
+	Text    string `json:"text"`
+	Tooltip string `json:"tooltip"`
+	Class   string `json:"class"`
+	Alt     string `json:"alt"`
+}
+
+// runWaybar prints the focused workspace's stack for a Waybar custom
+// module until killed. A module config looks like:
+//
+//	"custom/hypr-buddy": {
+//	  "exec": "hypr-buddy -waybar",
+//	  "return-type": "json",
+//	  "on-click": "hypr-buddy -waybar-click left",
+//	  "on-click-right": "hypr-buddy -waybar-click right",
+//	  "on-scroll-up": "hypr-buddy -waybar-click scroll-up",
+//	  "on-scroll-down": "hypr-buddy -waybar-click scroll-down"
+//	}
+//
+// If the daemon isn't running, or restarts, the module is blanked and we
+// keep trying to reconnect.
+func runWaybar() {
+	titleChanged := make(chan struct{}, 1)
+	go watchTitles(titleChanged)
+
+	enc := json.NewEncoder(os.Stdout)
+
+	for {
+		err := waybarSession(enc, titleChanged)
+		log.Printf("waybar: %s", err)
+
+		enc.Encode(waybarOutput{})
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// waybarSession prints a line for every state update from the daemon,
+// and every time a window title changes, until the connection to the
+// daemon fails.
+func waybarSession(enc *json.Encoder, titleChanged chan struct{}) error {
+	sub, err := client.NewClient().Subscribe(context.Background())
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	states := make(chan *client.State)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			st, err := sub.Next()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case states <- st:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var last *client.State
+	for {
+		select {
+		case st := <-states:
+			last = st
+		case <-titleChanged:
+			if last == nil {
+				continue
+			}
+		case err := <-errs:
+			return err
+		}
+
+		out, err := waybarRender(last)
+		if err != nil {
+			return err
+		}
+		enc.Encode(out)
+	}
+}
+
+// watchTitles signals on ch when a window title changes, since the
+// daemon's state only has addresses. Titles are best effort so errors
+// just stop the watch.
+func watchTitles(ch chan struct{}) {
+	events, err := hyprctl.NewEventReader()
+	if err != nil {
+		log.Printf("waybar: %s", err)
+		return
+	}
+	defer events.Close()
+
+	for {
+		evt, err := events.Next()
+		if err != nil {
+			log.Printf("waybar: %s", err)
+			return
+		}
+
+		if _, ok := evt.(hyprctl.WindowTitleV2Event); ok {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func waybarRender(st *client.State) (waybarOutput, error) {
+	ws := st.Workspace
+	if ws == nil {
+		return waybarOutput{}, nil
+	}
+
+	c, err := hyprctl.New()
+	if err != nil {
+		return waybarOutput{}, err
+	}
+
+	allWindows, err := c.Windows()
+	if err != nil {
+		return waybarOutput{}, err
+	}
+
+	windowsByID := make(map[string]hyprctl.Window)
+	for _, w := range allWindows {
+		windowsByID[w.Address] = w
+	}
+
+	out := waybarOutput{
+		Class: ws.Layout,
+		Alt:   ws.Layout,
+	}
+
+	if ws.Layout == "stacked" && len(ws.Windows) > 0 {
+		master := windowsByID[ws.Windows[0]]
+
+		// number the windows by their place in the window order: the
+		// master is always first and the hidden windows follow in the
+		// order -focus-next will show them
+		out.Text = fmt.Sprintf("[1/%d] %s", len(ws.Windows), html.EscapeString(master.Class))
+		inOrder := false
+		for _, addr := range ws.Windows {
+			inOrder = inOrder || addr == st.ActiveWindow
+		}
+		if !inOrder {
+			out.Text = positionUnknown(len(ws.Windows), windowsByID, st.ActiveWindow)
+		}
+
+		if len(ws.Windows) == 1 {
+			out.Tooltip = "no hidden windows"
+		} else {
+			lines := make([]string, 0, len(ws.Windows)-1)
+			for i, addr := range ws.Windows[1:] {
+				w := windowsByID[addr]
+				lines = append(lines, fmt.Sprintf("%d. %s", i+2, html.EscapeString(windowLabel(w))))
+			}
+			out.Tooltip = strings.Join(lines, "\n")
+		}
+
+		return out, nil
+	}
+
+	// otherwise show the focused window's position in the layout. The
+	// grid and centered layouts keep their window order; the master
+	// layout is Hyprland's, so go by where the windows are
+	var tiled []hyprctl.Window
+	if ws.Layout == "grid" || ws.Layout == "centered" {
+		for _, addr := range ws.Windows {
+			tiled = append(tiled, windowsByID[addr])
+		}
+	} else {
+		for _, w := range allWindows {
+			if w.Workspace.ID == ws.ID && !w.Floating {
+				tiled = append(tiled, w)
+			}
+		}
+		sort.Sort(WindowSort(tiled))
+	}
+	if len(tiled) == 0 {
+		return out, nil
+	}
+
+	pos := -1
+	for i, w := range tiled {
+		if w.Address == st.ActiveWindow {
+			pos = i
+		}
+	}
+
+	if pos < 0 {
+		out.Text = positionUnknown(len(tiled), windowsByID, st.ActiveWindow)
+	} else {
+		out.Text = fmt.Sprintf("[%d/%d] %s", pos+1, len(tiled), html.EscapeString(tiled[pos].Class))
+	}
+	out.Tooltip = "no hidden windows"
+
+	return out, nil
+}
+
+// positionUnknown is the module text for an active window that has no
+// place in the layout, such as a floating or scratchpad window.
+func positionUnknown(n int, windowsByID map[string]hyprctl.Window, active string) string {
+	text := fmt.Sprintf("[-/%d]", n)
+	if w, ok := windowsByID[active]; ok {
+		text += " " + html.EscapeString(w.Class)
+	}
+	return text
+}
+
+func windowLabel(w hyprctl.Window) string {
+	if w.Title == "" {
+		return w.Class
+	}
+	return fmt.Sprintf("%s: %s", w.Class, w.Title)
+}
+
+// waybarClick handles a click on the module.
+func waybarClick(button string) error {
+	c := client.NewClient()
+
+	switch button {
+	case "left", "scroll-down":
+		return c.FocusNext()
+	case "right", "scroll-up":
+		return c.FocusPrev()
+	}
+	return fmt.Errorf("unknown waybar click %q (want left, right, scroll-up or scroll-down)", button)
+}